@@ -2,12 +2,19 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"time"
 
 	di "github.com/vmindtech/vke-cluster-agent"
 	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/internal/service"
 	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/maintenance"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -15,9 +22,23 @@ import (
 
 func main() {
 	klog.InitFlags(nil)
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file, overridden by environment variables")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
 	flag.Parse()
 
-	configureManager := config.NewConfigureManager()
+	configureManager, err := config.NewConfigureManager(*configFile)
+	if *printConfig && configureManager != nil {
+		fmt.Print(config.FormatSettings(configureManager.GetEffectiveSettings()))
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to load configuration",
+			"component", "startup")
+		os.Exit(1)
+	}
+	if *printConfig {
+		return
+	}
+
 	clID := configureManager.GetVKEConfig().ClusterID
 
 	klog.V(0).InfoS("Starting VKE cluster agent",
@@ -27,6 +48,49 @@ func main() {
 		"version", configureManager.GetWebConfig().Version,
 		"component", "startup")
 
+	renewalConfig := configureManager.GetRenewalConfig()
+	klog.V(0).InfoS("Effective renewal timing",
+		"cluster_id", clID,
+		"check_interval", renewalConfig.CheckInterval,
+		"vke_check_interval", renewalConfig.VKECheckInterval,
+		"warn_threshold", renewalConfig.WarnThreshold,
+		"maintenance_window", renewalConfig.MaintenanceWindow,
+		"force_threshold", renewalConfig.ForceThreshold,
+		"master_stagger", renewalConfig.MasterStagger,
+		"rollout_poll_interval", renewalConfig.RolloutPollInterval,
+		"certificate_lifetime", renewalConfig.CertificateLifetime,
+		"simulation_time", configureManager.GetSimulationConfig().Time,
+		"simulation_offset", configureManager.GetSimulationConfig().Offset,
+		"component", "startup")
+	maintenanceConfig := configureManager.GetMaintenanceConfig()
+	for _, action := range []string{constants.ActionMasterRenewal, constants.ActionWorkerRestart, constants.ActionRemediation} {
+		windows := maintenanceConfig.WindowsFor(action)
+		if len(windows) == 0 {
+			klog.V(0).InfoS("No maintenance window configured, action is always allowed",
+				"action", action,
+				"component", "startup")
+			continue
+		}
+		nextStart, nextEnd, _ := maintenance.Next(windows, time.Now().In(maintenanceConfig.Location))
+		klog.V(0).InfoS("Maintenance windows",
+			"action", action,
+			"windows", windows,
+			"timezone", maintenanceConfig.Location,
+			"next_start", nextStart,
+			"next_end", nextEnd,
+			"component", "startup")
+	}
+	for _, freeze := range maintenanceConfig.Freezes {
+		klog.V(0).InfoS("Change freeze",
+			"name", freeze.Name,
+			"start", freeze.Start,
+			"end", freeze.End,
+			"component", "startup")
+	}
+	klog.V(2).InfoS("Effective configuration",
+		"settings", configureManager.GetEffectiveSettings(),
+		"component", "startup")
+
 	k8sConfig, err := rest.InClusterConfig()
 	if err != nil {
 		klog.ErrorS(err, "Failed to get in-cluster config",
@@ -45,31 +109,108 @@ func main() {
 
 	appService := di.InitAppService(k8sClient, k8sConfig)
 
-	for {
-		isExpired := make(chan bool)
-		go appService.CheckVKEClusterCertificateExpiration(isExpired)
+	go appService.WatchConfigMap(make(chan struct{}))
+
+	if address := configureManager.GetMetricsConfig().Address; address != "" {
+		go serveHTTP(address)
+	}
+
+	go runPeriodically("loadbalancer_reconciler",
+		func() time.Duration { return configureManager.GetLoadbalancerConfig().ReconcileInterval },
+		appService.ReconcileLoadbalancer)
+	go runPeriodically("node_remediator",
+		func() time.Duration { return configureManager.GetRemediationConfig().Interval },
+		appService.RemediateNotReadyNodes)
+	go runPeriodically("node_identity",
+		func() time.Duration { return configureManager.GetNodeIdentityConfig().SyncInterval },
+		appService.SyncNodeIdentity)
+	go runPeriodically("kubeconfig_sync",
+		func() time.Duration { return configureManager.GetKubeconfigConfig().DriftCheckInterval },
+		appService.SyncKubeconfig)
+	go runPeriodically("rollout_follower",
+		func() time.Duration { return configureManager.GetRenewalConfig().RolloutPollInterval },
+		appService.FollowRollout)
+	go runPeriodically("certificate_metrics",
+		func() time.Duration { return configureManager.GetMetricsConfig().CertificateScanInterval },
+		appService.RecordCertificateExpiry)
 
+	// A single checker runs for the agent's lifetime. The buffer lets it
+	// leave a decision behind while a renewal is still running.
+	decisions := make(chan model.RenewalDecision, 1)
+	go appService.CheckVKEClusterCertificateExpiration(decisions)
+
+	for decision := range decisions {
+		renewCertificates(appService, decision)
+
+		// A decision sent while the renewal ran predates its outcome.
 		select {
-		case expired := <-isExpired:
-			if expired {
-				klog.V(0).Info("Certificate expiration detected, starting renewal process")
-
-				if err := appService.RenewMasterNodesCertificates(); err != nil {
-					klog.Errorf("Failed to renew master certificates: %v", err)
-					continue
-				}
-
-				if err := appService.RestartWorkerNodes(); err != nil {
-					klog.Errorf("Failed to restart worker nodes: %v", err)
-					continue
-				}
-
-				klog.V(0).Info("Certificate renewal process completed successfully")
-			}
-		case <-time.After(constants.RenewalProcessTimeout):
-			klog.V(2).Info("Renewal process timed out, restarting check cycle")
+		case <-decisions:
+		default:
+		}
+		time.Sleep(configureManager.GetRenewalConfig().CheckInterval)
+	}
+}
+
+// renewCertificates runs one renewal cycle for decision. A deferred renewal,
+// outside a maintenance window, during a freeze, waiting for approval or
+// while paused, is the normal outcome and only logged.
+func renewCertificates(appService service.IAppService, decision model.RenewalDecision) {
+	klog.V(0).Infof("Certificate expiration detected, starting renewal process - tier: %s, reason: %s", decision.Tier, decision.Reason)
+
+	if err := appService.RenewMasterNodesCertificates(decision); err != nil {
+		if service.IsRenewalDeferred(err) {
+			klog.V(0).Infof("Certificate renewal deferred: %v", err)
+		} else {
+			klog.Errorf("Failed to renew master certificates: %v", err)
 		}
+		return
+	}
+
+	klog.V(2).Info("Certificate renewal cycle completed")
+}
 
-		time.Sleep(constants.CertificateCheckInterval)
+// serveHTTP serves the metrics and health endpoints on address. The agent
+// keeps running without them when the address cannot be bound.
+func serveHTTP(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.Handler(func() []string {
+		return health.Live(healthLimits())
+	}))
+	mux.Handle("/readyz", health.Handler(func() []string {
+		return health.Ready(healthLimits())
+	}))
+
+	klog.V(0).InfoS("Serving metrics and health checks",
+		"address", address,
+		"component", "http")
+	if err := http.ListenAndServe(address, mux); err != nil {
+		klog.ErrorS(err, "HTTP server stopped",
+			"address", address,
+			"component", "http")
+	}
+}
+
+// healthLimits reads the health limits from the current configuration so
+// reloads apply to the next probe.
+func healthLimits() health.Limits {
+	healthConfig := config.GlobalConfig.GetHealthConfig()
+	return health.Limits{
+		Heartbeat:  healthConfig.HeartbeatTimeout,
+		Phase:      healthConfig.PhaseTimeout,
+		Dependency: healthConfig.DependencyTimeout,
+	}
+}
+
+// runPeriodically runs job forever, waiting interval between two runs. The
+// interval is read again after every run so configuration changes apply.
+// Errors are logged and do not stop the loop.
+func runPeriodically(component string, interval func() time.Duration, job func() error) {
+	for {
+		if err := job(); err != nil {
+			klog.ErrorS(err, "Periodic job failed",
+				"component", component)
+		}
+		time.Sleep(interval())
 	}
 }
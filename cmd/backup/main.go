@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	di "github.com/vmindtech/vke-cluster-agent"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/service"
+	"k8s.io/klog/v2"
+)
+
+const usage = `Usage:
+  vke-cluster-backup [-config FILE] [-node NAME] list
+  vke-cluster-backup [-config FILE] [-o FILE] fetch OBJECT
+
+list prints the TLS backups stored in Swift, fetch downloads one, decrypts it
+and writes the tar.gz archive to FILE (default: the object's base name).
+`
+
+func main() {
+	klog.InitFlags(nil)
+	nodeName := flag.String("node", "", "only list backups of this node")
+	output := flag.String("o", "", "file to write the fetched backup to")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML config file, overridden by environment variables")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	configureManager, err := config.NewConfigureManager(*configFile)
+	if err != nil {
+		klog.ErrorS(err, "Failed to load configuration")
+		os.Exit(1)
+	}
+	vkeConfig := configureManager.GetVKEConfig()
+
+	providerClient, err := service.NewOpenstackService().ValidateAndCreateSession(
+		vkeConfig.ProjectID,
+		vkeConfig.ApplicationCredentialID,
+		vkeConfig.ApplicationCredentialSecret,
+		vkeConfig.IdentityURL,
+	)
+	if err != nil {
+		klog.ErrorS(err, "Failed to create openstack session")
+		os.Exit(1)
+	}
+
+	backupService := di.InitBackupService()
+
+	switch flag.Arg(0) {
+	case "list":
+		backups, err := backupService.ListBackups(providerClient, *nodeName)
+		if err != nil {
+			klog.ErrorS(err, "Failed to list backups")
+			os.Exit(1)
+		}
+		for _, backup := range backups {
+			fmt.Printf("%s\t%d\t%s\n", backup.Name, backup.Bytes, backup.LastModified.Format("2006-01-02T15:04:05Z07:00"))
+		}
+	case "fetch":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		name := flag.Arg(1)
+
+		archive, err := backupService.FetchBackup(providerClient, name)
+		if err != nil {
+			klog.ErrorS(err, "Failed to fetch backup", "object", name)
+			os.Exit(1)
+		}
+
+		target := *output
+		if target == "" {
+			target = strings.TrimSuffix(path.Base(name), ".enc")
+		}
+		if err := os.WriteFile(target, archive, 0600); err != nil {
+			klog.ErrorS(err, "Failed to write backup", "file", target)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", target)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
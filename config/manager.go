@@ -1,9 +1,16 @@
 package config
 
 import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/viper"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/maintenance"
+	"github.com/vmindtech/vke-cluster-agent/pkg/utils"
 	"golang.org/x/text/language"
 )
 
@@ -11,57 +18,171 @@ const (
 	EnvironmentTypeLocal = "local"
 )
 
+// defaults are applied below the config file and the environment.
+var defaults = map[string]interface{}{
+	"VKE_APPLICATION_CREDENTIAL_EXPIRY_THRESHOLDS": "720h,168h,24h",
+	"RENEWAL_CHECK_INTERVAL":                       "1h",
+	"RENEWAL_VKE_CHECK_INTERVAL":                   "1h",
+	"RENEWAL_WARN_THRESHOLD":                       "720h",
+	"RENEWAL_MAINTENANCE_WINDOW":                   "168h",
+	"RENEWAL_FORCE_THRESHOLD":                      "48h",
+	"RENEWAL_MASTER_STAGGER":                       "2m",
+	"RENEWAL_ROLLOUT_POLL_INTERVAL":                "30s",
+	"RENEWAL_CERTIFICATE_LIFETIME":                 "8616h",
+	"MAINTENANCE_TIMEZONE":                         "UTC",
+	"MAINTENANCE_FREEZE_EMERGENCY_OVERRIDE":        "true",
+	"MAINTENANCE_FREEZE_EMERGENCY_THRESHOLD":       "72h",
+	"MAINTENANCE_PAUSED":                           false,
+	"CLUSTER_DISTRIBUTION":                         constants.DistributionAuto,
+	"LOADBALANCER_RECONCILE_INTERVAL":              "5m",
+	"LOADBALANCER_MEMBER_HEALTH_TIMEOUT":           "10m",
+	"LOADBALANCER_ALLOWED_CIDRS_DRY_RUN":           false,
+	"REMEDIATION_ENABLED":                          false,
+	"REMEDIATION_INTERVAL":                         "1m",
+	"REMEDIATION_NOT_READY_TIMEOUT":                "10m",
+	"REMEDIATION_MAX_ACTIONS":                      3,
+	"REMEDIATION_ACTION_WINDOW":                    "24h",
+	"REMEDIATION_MAX_UNHEALTHY_NODES":              2,
+	"NODE_IDENTITY_SYNC_INTERVAL":                  "1h",
+	"BACKUP_ENABLED":                               false,
+	"BACKUP_SWIFT_CONTAINER":                       "vke-cluster-agent-backups",
+	"BACKUP_RETENTION":                             5,
+	"KUBECONFIG_BARBICAN_ENABLED":                  false,
+	"KUBECONFIG_BARBICAN_SECRET_PREFIX":            "vke-kubeconfig",
+	"KUBECONFIG_DRIFT_CHECK_INTERVAL":              "15m",
+	"KUBECONFIG_ADMIN_CSR_ENABLED":                 false,
+	"KUBECONFIG_ADMIN_USER":                        "vke-cluster-admin",
+	"KUBECONFIG_ADMIN_GROUPS":                      "system:masters",
+	"KUBECONFIG_ADMIN_CERTIFICATE_LIFETIME":        "8760h",
+	"KUBECONFIG_ENCRYPTION_ENABLED":                false,
+	"POD_NAMESPACE":                                "kube-system",
+	"CONFIG_MAP_NAME":                              "vke-cluster-agent-config",
+	"APPROVAL_ENABLED":                             false,
+	"APPROVAL_CONFIG_MAP_NAME":                     "vke-cluster-agent-renewal-approval",
+	"APPROVAL_TIMEOUT":                             "48h",
+	"METRICS_ADDRESS":                              ":9849",
+	"METRICS_CERTIFICATE_SCAN_INTERVAL":            "5m",
+	"HEALTH_HEARTBEAT_TIMEOUT":                     "3h",
+	"HEALTH_PHASE_TIMEOUT":                         "2h",
+	"HEALTH_DEPENDENCY_TIMEOUT":                    "3h",
+	"EVENTS_DEDUP_INTERVAL":                        "6h",
+	"EVENTS_STATUS_CONFIG_MAP_NAME":                "vke-cluster-agent-status",
+}
+
 var GlobalConfig IConfigureManager
 
 type IConfigureManager interface {
 	GetWebConfig() AgentConfig
 	GetLanguageConfig() LanguageConfig
 	GetVKEConfig() VKEConfig
-	GetIsTestMode() bool
+	GetRenewalConfig() RenewalConfig
+	GetDistributionConfig() DistributionConfig
+	GetLoadbalancerConfig() LoadbalancerConfig
+	GetRemediationConfig() RemediationConfig
+	GetNodeIdentityConfig() NodeIdentityConfig
+	GetBackupConfig() BackupConfig
+	GetKubeconfigConfig() KubeconfigConfig
+	GetMaintenanceConfig() MaintenanceConfig
+	GetApprovalConfig() ApprovalConfig
+	GetMetricsConfig() MetricsConfig
+	GetHealthConfig() HealthConfig
+	GetEventsConfig() EventsConfig
+	GetSimulationConfig() SimulationConfig
+	// GetEffectiveSettings returns every setting the agent read with its
+	// effective value. Secrets are redacted.
+	GetEffectiveSettings() map[string]string
 }
 
 type configureManager struct {
-	Web        AgentConfig
-	Language   LanguageConfig
-	VKE        VKEConfig
-	IsTestMode bool
+	Web          AgentConfig
+	Language     LanguageConfig
+	VKE          VKEConfig
+	Renewal      RenewalConfig
+	Distribution DistributionConfig
+	Loadbalancer LoadbalancerConfig
+	Remediation  RemediationConfig
+	NodeIdentity NodeIdentityConfig
+	Backup       BackupConfig
+	Kubeconfig   KubeconfigConfig
+	Maintenance  MaintenanceConfig
+	Approval     ApprovalConfig
+	Metrics      MetricsConfig
+	Health       HealthConfig
+	Events       EventsConfig
+	Simulation   SimulationConfig
+	Settings     map[string]string
+	rawSettings  map[string]string
 }
 
-func NewConfigureManager() IConfigureManager {
+// NewConfigureManager loads the configuration from the defaults, the optional
+// configFile (YAML or JSON, keys named like the environment variables) and
+// the environment, in increasing order of precedence. Every missing or
+// malformed value is reported in a single *ValidationError. The manager is
+// returned even then so the effective settings can still be printed.
+func NewConfigureManager(configFile string) (IConfigureManager, error) {
+	for key, value := range defaults {
+		viper.SetDefault(key, value)
+	}
 	viper.AutomaticEnv()
 
-	if os.Getenv("golang_env") == "development" {
-		configFile := "config-" + os.Getenv("golang_env") + ".json"
-		viper.SetConfigFile(configFile)
-		viper.SetConfigType("json")
-
-		err := viper.ReadInConfig()
-		if err != nil {
-			if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-				panic(err)
-			}
+	if configFile == "" && os.Getenv("golang_env") == "development" {
+		configFile = "config-" + os.Getenv("golang_env") + ".json"
+		if _, err := os.Stat(configFile); err != nil {
+			configFile = ""
 		}
 	}
 
-	GlobalConfig = &configureManager{
-		Web:        loadWebConfig(),
-		Language:   loadLanguageConfig(),
-		VKE:        loadVKEConfig(),
-		IsTestMode: loadIsTestMode(),
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %v", configFile, err)
+		}
 	}
 
-	return GlobalConfig
+	manager, err := loadConfigureManager(viper.GetString)
+	GlobalConfig = newLiveConfig(manager)
+	return GlobalConfig, err
 }
 
-func loadIsTestMode() bool {
-	return viper.GetBool("IS_TEST_MODE")
+// loadConfigureManager builds a configureManager from source and validates
+// it.
+func loadConfigureManager(source func(key string) string) (*configureManager, error) {
+	v := newValidator(source)
+	manager := &configureManager{
+		Web:          loadWebConfig(v),
+		Language:     loadLanguageConfig(),
+		VKE:          loadVKEConfig(v),
+		Renewal:      loadRenewalConfig(v),
+		Distribution: loadDistributionConfig(v),
+		Loadbalancer: loadLoadbalancerConfig(v),
+		Remediation:  loadRemediationConfig(v),
+		NodeIdentity: loadNodeIdentityConfig(v),
+		Backup:       loadBackupConfig(v),
+		Kubeconfig:   loadKubeconfigConfig(v),
+		Maintenance:  loadMaintenanceConfig(v),
+		Approval:     loadApprovalConfig(v),
+		Metrics:      loadMetricsConfig(v),
+		Health:       loadHealthConfig(v),
+		Events:       loadEventsConfig(v),
+		Simulation:   loadSimulationConfig(v),
+	}
+	if manager.Health.HeartbeatTimeout > 0 && manager.Health.HeartbeatTimeout <= manager.Renewal.VKECheckInterval {
+		v.addf("HEALTH_HEARTBEAT_TIMEOUT", "must be longer than RENEWAL_VKE_CHECK_INTERVAL or an idle agent is restarted")
+	}
+	manager.Settings = v.redactedSettings()
+	manager.rawSettings = v.settings
+
+	return manager, v.err()
 }
 
-func loadWebConfig() AgentConfig {
+func loadWebConfig(v *validator) AgentConfig {
 	return AgentConfig{
-		AppName: viper.GetString("APP_NAME"),
-		Env:     viper.GetString("ENV"),
-		Version: viper.GetString("VERSION"),
+		AppName:       v.string("APP_NAME"),
+		Env:           v.string("ENV"),
+		Version:       v.string("VERSION"),
+		LogVerbosity:  v.optionalInt("LOG_VERBOSITY"),
+		Namespace:     v.string("POD_NAMESPACE"),
+		ConfigMapName: v.string("CONFIG_MAP_NAME"),
 	}
 }
 
@@ -86,17 +207,280 @@ func (c *configureManager) GetVKEConfig() VKEConfig {
 	return c.VKE
 }
 
-func (c *configureManager) GetIsTestMode() bool {
-	return c.IsTestMode
+func (c *configureManager) GetRenewalConfig() RenewalConfig {
+	return c.Renewal
+}
+
+func (c *configureManager) GetDistributionConfig() DistributionConfig {
+	return c.Distribution
+}
+
+func (c *configureManager) GetLoadbalancerConfig() LoadbalancerConfig {
+	return c.Loadbalancer
+}
+
+func (c *configureManager) GetRemediationConfig() RemediationConfig {
+	return c.Remediation
+}
+
+func (c *configureManager) GetNodeIdentityConfig() NodeIdentityConfig {
+	return c.NodeIdentity
+}
+
+func (c *configureManager) GetBackupConfig() BackupConfig {
+	return c.Backup
+}
+
+func (c *configureManager) GetKubeconfigConfig() KubeconfigConfig {
+	return c.Kubeconfig
+}
+
+func (c *configureManager) GetMaintenanceConfig() MaintenanceConfig {
+	return c.Maintenance
+}
+
+func (c *configureManager) GetApprovalConfig() ApprovalConfig {
+	return c.Approval
 }
 
-func loadVKEConfig() VKEConfig {
+func (c *configureManager) GetMetricsConfig() MetricsConfig {
+	return c.Metrics
+}
+
+func (c *configureManager) GetHealthConfig() HealthConfig {
+	return c.Health
+}
+
+func (c *configureManager) GetEventsConfig() EventsConfig {
+	return c.Events
+}
+
+func (c *configureManager) GetSimulationConfig() SimulationConfig {
+	return c.Simulation
+}
+
+func (c *configureManager) GetEffectiveSettings() map[string]string {
+	return c.Settings
+}
+
+func loadVKEConfig(v *validator) VKEConfig {
 	return VKEConfig{
-		ClusterID:                   viper.GetString("VKE_CLUSTER_ID"),
-		ProjectID:                   viper.GetString("VKE_PROJECT_ID"),
-		IdentityURL:                 viper.GetString("VKE_IDENTITY_URL"),
-		VKEURL:                      viper.GetString("VKE_URL"),
-		ApplicationCredentialID:     viper.GetString("VKE_APPLICATION_CREDENTIAL_ID"),
-		ApplicationCredentialSecret: viper.GetString("VKE_APPLICATION_CREDENTIAL_SECRET"),
+		ClusterID:                             v.uuid("VKE_CLUSTER_ID"),
+		ProjectID:                             v.id("VKE_PROJECT_ID"),
+		IdentityURL:                           v.url("VKE_IDENTITY_URL"),
+		VKEURL:                                v.url("VKE_URL"),
+		ApplicationCredentialID:               v.id("VKE_APPLICATION_CREDENTIAL_ID"),
+		ApplicationCredentialSecret:           v.requiredSecret("VKE_APPLICATION_CREDENTIAL_SECRET"),
+		Region:                                v.string("VKE_REGION"),
+		ApplicationCredentialExpiryThresholds: v.durationList("VKE_APPLICATION_CREDENTIAL_EXPIRY_THRESHOLDS"),
+	}
+}
+
+func loadRenewalConfig(v *validator) RenewalConfig {
+	renewalConfig := RenewalConfig{
+		CheckInterval:       v.duration("RENEWAL_CHECK_INTERVAL"),
+		VKECheckInterval:    v.duration("RENEWAL_VKE_CHECK_INTERVAL"),
+		WarnThreshold:       v.duration("RENEWAL_WARN_THRESHOLD"),
+		MaintenanceWindow:   v.duration("RENEWAL_MAINTENANCE_WINDOW"),
+		ForceThreshold:      v.duration("RENEWAL_FORCE_THRESHOLD"),
+		MasterStagger:       v.duration("RENEWAL_MASTER_STAGGER"),
+		RolloutPollInterval: v.duration("RENEWAL_ROLLOUT_POLL_INTERVAL"),
+		CertificateLifetime: v.duration("RENEWAL_CERTIFICATE_LIFETIME"),
+	}
+
+	if renewalConfig.MaintenanceWindow > 0 && renewalConfig.MaintenanceWindow <= renewalConfig.VKECheckInterval {
+		v.addf("RENEWAL_MAINTENANCE_WINDOW", "must be longer than RENEWAL_VKE_CHECK_INTERVAL or an expiry can be missed")
+	}
+	if renewalConfig.CertificateLifetime > 0 && renewalConfig.MaintenanceWindow >= renewalConfig.CertificateLifetime {
+		v.addf("RENEWAL_MAINTENANCE_WINDOW", "must be shorter than RENEWAL_CERTIFICATE_LIFETIME")
+	}
+	if renewalConfig.WarnThreshold > 0 && renewalConfig.WarnThreshold < renewalConfig.MaintenanceWindow {
+		v.addf("RENEWAL_WARN_THRESHOLD", "must not be shorter than RENEWAL_MAINTENANCE_WINDOW")
+	}
+	if renewalConfig.CertificateLifetime > 0 && renewalConfig.WarnThreshold >= renewalConfig.CertificateLifetime {
+		v.addf("RENEWAL_WARN_THRESHOLD", "must be shorter than RENEWAL_CERTIFICATE_LIFETIME")
+	}
+	if renewalConfig.ForceThreshold > 0 && renewalConfig.ForceThreshold >= renewalConfig.MaintenanceWindow {
+		v.addf("RENEWAL_FORCE_THRESHOLD", "must be shorter than RENEWAL_MAINTENANCE_WINDOW")
+	}
+	if renewalConfig.ForceThreshold > 0 && renewalConfig.ForceThreshold <= renewalConfig.VKECheckInterval {
+		v.addf("RENEWAL_FORCE_THRESHOLD", "must be longer than RENEWAL_VKE_CHECK_INTERVAL or an expiry can be missed")
+	}
+
+	return renewalConfig
+}
+
+func loadMaintenanceConfig(v *validator) MaintenanceConfig {
+	windows, _ := v.windows("MAINTENANCE_WINDOWS")
+	location := v.location("MAINTENANCE_TIMEZONE")
+	maintenanceConfig := MaintenanceConfig{
+		Location:           location,
+		Windows:            windows,
+		ActionWindows:      map[string][]maintenance.Window{},
+		Freezes:            v.freezes("MAINTENANCE_FREEZE_PERIODS", location),
+		EmergencyOverride:  v.bool("MAINTENANCE_FREEZE_EMERGENCY_OVERRIDE"),
+		EmergencyThreshold: v.duration("MAINTENANCE_FREEZE_EMERGENCY_THRESHOLD"),
+		Paused:             v.bool("MAINTENANCE_PAUSED"),
+	}
+
+	for _, action := range []string{constants.ActionMasterRenewal, constants.ActionWorkerRestart, constants.ActionRemediation} {
+		if actionWindows, set := v.windows("MAINTENANCE_WINDOWS_" + strings.ToUpper(action)); set {
+			maintenanceConfig.ActionWindows[action] = actionWindows
+		}
 	}
+
+	return maintenanceConfig
+}
+
+func loadApprovalConfig(v *validator) ApprovalConfig {
+	return ApprovalConfig{
+		Enabled:       v.bool("APPROVAL_ENABLED"),
+		ConfigMapName: v.required("APPROVAL_CONFIG_MAP_NAME"),
+		Timeout:       v.duration("APPROVAL_TIMEOUT"),
+	}
+}
+
+func loadMetricsConfig(v *validator) MetricsConfig {
+	return MetricsConfig{
+		Address:                 v.string("METRICS_ADDRESS"),
+		CertificateScanInterval: v.duration("METRICS_CERTIFICATE_SCAN_INTERVAL"),
+	}
+}
+
+func loadHealthConfig(v *validator) HealthConfig {
+	return HealthConfig{
+		HeartbeatTimeout:  v.duration("HEALTH_HEARTBEAT_TIMEOUT"),
+		PhaseTimeout:      v.duration("HEALTH_PHASE_TIMEOUT"),
+		DependencyTimeout: v.duration("HEALTH_DEPENDENCY_TIMEOUT"),
+	}
+}
+
+func loadEventsConfig(v *validator) EventsConfig {
+	return EventsConfig{
+		DedupInterval:       v.duration("EVENTS_DEDUP_INTERVAL"),
+		StatusConfigMapName: v.required("EVENTS_STATUS_CONFIG_MAP_NAME"),
+	}
+}
+
+func loadSimulationConfig(v *validator) SimulationConfig {
+	simulationConfig := SimulationConfig{
+		Time:   v.time("SIMULATION_TIME"),
+		Offset: v.offset("SIMULATION_OFFSET"),
+	}
+
+	if !simulationConfig.Time.IsZero() && simulationConfig.Offset != 0 {
+		v.addf("SIMULATION_TIME", "cannot be combined with SIMULATION_OFFSET")
+	}
+
+	return simulationConfig
+}
+
+func loadDistributionConfig(v *validator) DistributionConfig {
+	return DistributionConfig{
+		Name: v.oneOf("CLUSTER_DISTRIBUTION",
+			constants.DistributionAuto,
+			constants.DistributionRKE2,
+			constants.DistributionK3s,
+			constants.DistributionKubeadm,
+		),
+	}
+}
+
+func loadLoadbalancerConfig(v *validator) LoadbalancerConfig {
+	return LoadbalancerConfig{
+		ReconcileInterval:   v.duration("LOADBALANCER_RECONCILE_INTERVAL"),
+		MemberHealthTimeout: v.duration("LOADBALANCER_MEMBER_HEALTH_TIMEOUT"),
+		AllowedCIDRsDryRun:  v.bool("LOADBALANCER_ALLOWED_CIDRS_DRY_RUN"),
+	}
+}
+
+func loadRemediationConfig(v *validator) RemediationConfig {
+	return RemediationConfig{
+		Enabled:           v.bool("REMEDIATION_ENABLED"),
+		Interval:          v.duration("REMEDIATION_INTERVAL"),
+		NotReadyTimeout:   v.duration("REMEDIATION_NOT_READY_TIMEOUT"),
+		MaxActions:        v.positiveInt("REMEDIATION_MAX_ACTIONS"),
+		ActionWindow:      v.duration("REMEDIATION_ACTION_WINDOW"),
+		MaxUnhealthyNodes: v.positiveInt("REMEDIATION_MAX_UNHEALTHY_NODES"),
+	}
+}
+
+func loadNodeIdentityConfig(v *validator) NodeIdentityConfig {
+	return NodeIdentityConfig{
+		SyncInterval:    v.duration("NODE_IDENTITY_SYNC_INTERVAL"),
+		ConfigDrivePath: v.string("NODE_IDENTITY_CONFIG_DRIVE_PATH"),
+	}
+}
+
+func loadBackupConfig(v *validator) BackupConfig {
+	enabled := v.bool("BACKUP_ENABLED")
+
+	var encryptionKey []byte
+	if raw := v.secret("BACKUP_ENCRYPTION_KEY"); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != 32 {
+			v.addf("BACKUP_ENCRYPTION_KEY", "expected 32 base64 encoded bytes")
+		} else {
+			encryptionKey = key
+		}
+	} else if enabled {
+		v.addf("BACKUP_ENCRYPTION_KEY", "is required when BACKUP_ENABLED is true")
+	}
+
+	return BackupConfig{
+		Enabled:       enabled,
+		Container:     v.string("BACKUP_SWIFT_CONTAINER"),
+		EncryptionKey: encryptionKey,
+		Retention:     v.positiveInt("BACKUP_RETENTION"),
+	}
+}
+
+func loadKubeconfigConfig(v *validator) KubeconfigConfig {
+	encryptionEnabled := v.bool("KUBECONFIG_ENCRYPTION_ENABLED")
+
+	var encryptionPublicKey *rsa.PublicKey
+	if raw := loadKubeconfigEncryptionPublicKey(v); len(raw) > 0 {
+		key, err := utils.ParseRSAPublicKey(raw)
+		if err != nil {
+			v.addf("KUBECONFIG_ENCRYPTION_PUBLIC_KEY", "%v", err)
+		} else {
+			encryptionPublicKey = key
+		}
+	} else if encryptionEnabled {
+		v.addf("KUBECONFIG_ENCRYPTION_PUBLIC_KEY", "is required when KUBECONFIG_ENCRYPTION_ENABLED is true")
+	}
+
+	adminGroups := v.stringList("KUBECONFIG_ADMIN_GROUPS")
+	if len(adminGroups) == 0 {
+		v.addf("KUBECONFIG_ADMIN_GROUPS", "must not be empty")
+	}
+
+	return KubeconfigConfig{
+		BarbicanEnabled:          v.bool("KUBECONFIG_BARBICAN_ENABLED"),
+		BarbicanSecretPrefix:     v.string("KUBECONFIG_BARBICAN_SECRET_PREFIX"),
+		DriftCheckInterval:       v.duration("KUBECONFIG_DRIFT_CHECK_INTERVAL"),
+		AdminCSREnabled:          v.bool("KUBECONFIG_ADMIN_CSR_ENABLED"),
+		AdminUser:                v.required("KUBECONFIG_ADMIN_USER"),
+		AdminGroups:              adminGroups,
+		AdminCertificateLifetime: v.duration("KUBECONFIG_ADMIN_CERTIFICATE_LIFETIME"),
+		EncryptionEnabled:        encryptionEnabled,
+		EncryptionPublicKey:      encryptionPublicKey,
+	}
+}
+
+// loadKubeconfigEncryptionPublicKey reads the PEM public key from the file
+// named by KUBECONFIG_ENCRYPTION_PUBLIC_KEY_FILE, or from
+// KUBECONFIG_ENCRYPTION_PUBLIC_KEY itself.
+func loadKubeconfigEncryptionPublicKey(v *validator) []byte {
+	publicKey := v.string("KUBECONFIG_ENCRYPTION_PUBLIC_KEY")
+	if path := v.string("KUBECONFIG_ENCRYPTION_PUBLIC_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			v.addf("KUBECONFIG_ENCRYPTION_PUBLIC_KEY_FILE", "%v", err)
+			return nil
+		}
+		return data
+	}
+
+	return []byte(publicKey)
 }
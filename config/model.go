@@ -1,6 +1,10 @@
 package config
 
 import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/pkg/maintenance"
 	"golang.org/x/text/language"
 )
 
@@ -12,6 +16,13 @@ type AgentConfig struct {
 	AppName string
 	Env     string
 	Version string
+	// LogVerbosity overrides the -v flag when it is not negative.
+	LogVerbosity int
+	// Namespace is where the agent runs and looks for ConfigMapName.
+	Namespace string
+	// ConfigMapName is the ConfigMap whose data overrides the configuration
+	// at runtime.
+	ConfigMapName string
 }
 
 type LanguageConfig struct {
@@ -26,6 +37,201 @@ type VKEConfig struct {
 	ApplicationCredentialID     string
 	ApplicationCredentialSecret string
 	VKEURL                      string
+	Region                      string
+	// ApplicationCredentialExpiryThresholds are the remaining lifetimes at
+	// which the agent warns about its own application credential expiring.
+	ApplicationCredentialExpiryThresholds []time.Duration
+}
+
+type RenewalConfig struct {
+	// CheckInterval is how long the agent waits between two renewal cycles.
+	CheckInterval time.Duration
+	// VKECheckInterval is how often the certificate checker goroutine fetches
+	// the expiry from VKE, independently of the renewal cycles.
+	VKECheckInterval time.Duration
+	// WarnThreshold is how long before the certificate expiry the agent
+	// starts warning about it, without acting.
+	WarnThreshold time.Duration
+	// MaintenanceWindow is how long before the certificate expiry renewal
+	// is scheduled for the next maintenance window.
+	MaintenanceWindow time.Duration
+	// ForceThreshold is how long before the certificate expiry renewal
+	// starts right away, ignoring maintenance windows and change freezes.
+	ForceThreshold time.Duration
+	// MasterStagger is the delay between the restarts of two masters.
+	MasterStagger time.Duration
+	// RolloutPollInterval is how often the other nodes read the rollout the
+	// first master recorded.
+	RolloutPollInterval time.Duration
+	// CertificateLifetime is the validity reported to VKE for renewed
+	// certificates.
+	CertificateLifetime time.Duration
+}
+
+type MaintenanceConfig struct {
+	// Location is the time zone the windows are written in.
+	Location *time.Location
+	// Windows are the default maintenance windows. No windows means
+	// disruptive actions may start at any time.
+	Windows []maintenance.Window
+	// ActionWindows override Windows for a single action type, keyed by the
+	// constants.Action* names.
+	ActionWindows map[string][]maintenance.Window
+	// Freezes are change freezes during which no disruptive action starts.
+	// Freezes announced by VKE apply on top of these.
+	Freezes []maintenance.Freeze
+	// EmergencyOverride lets a renewal run during a freeze when the
+	// certificates would otherwise expire before the freeze ends.
+	EmergencyOverride bool
+	// EmergencyThreshold is how long before the certificate expiry the
+	// emergency override starts the renewal.
+	EmergencyThreshold time.Duration
+	// Paused stops every disruptive action, whatever the tier. Checks and
+	// reporting keep running.
+	Paused bool
+}
+
+// WindowsFor returns the maintenance windows that apply to action.
+func (m MaintenanceConfig) WindowsFor(action string) []maintenance.Window {
+	if windows, ok := m.ActionWindows[action]; ok {
+		return windows
+	}
+	return m.Windows
+}
+
+// SimulationConfig moves the time expiry decisions are taken at, to rehearse
+// renewals. Dates written to VKE always use the real time. At most one of
+// Time and Offset is set.
+type SimulationConfig struct {
+	// Time is the decision time when the agent starts. It advances with the
+	// wall clock.
+	Time time.Time
+	// Offset is added to the wall clock for decisions.
+	Offset time.Duration
+}
+
+type DistributionConfig struct {
+	// Name is the Kubernetes distribution the agent manages: rke2, k3s,
+	// kubeadm, or auto to detect it from the kubelet version.
+	Name string
+}
+
+type LoadbalancerConfig struct {
+	// ReconcileInterval is how often the API load balancer members are
+	// compared against the control-plane nodes.
+	ReconcileInterval time.Duration
+	// MemberHealthTimeout bounds how long a master waits for its pool members
+	// to come back ONLINE after the control plane has been restarted.
+	MemberHealthTimeout time.Duration
+	// AllowedCIDRsDryRun only logs the allowed_cidrs change that enforcing
+	// ClusterAPIAccess would make instead of applying it.
+	AllowedCIDRsDryRun bool
+}
+
+type RemediationConfig struct {
+	Enabled bool
+	// Interval is how often NotReady nodes are looked for.
+	Interval time.Duration
+	// NotReadyTimeout is how long a node has to be NotReady before it is
+	// rebooted, and how long to wait between two reboots of the same node.
+	NotReadyTimeout time.Duration
+	// MaxActions caps the number of reboots per node within ActionWindow.
+	MaxActions   int
+	ActionWindow time.Duration
+	// MaxUnhealthyNodes is the most nodes that may be due for a reboot at
+	// once. Above it nothing is rebooted.
+	MaxUnhealthyNodes int
+}
+
+type NodeIdentityConfig struct {
+	// SyncInterval is how often the node labels are compared against the
+	// instance the agent runs on.
+	SyncInterval time.Duration
+	// ConfigDrivePath is where the config drive is mounted. When empty or
+	// unreadable the metadata service is used.
+	ConfigDrivePath string
+}
+
+type BackupConfig struct {
+	Enabled bool
+	// Container is the Swift container backups are uploaded to.
+	Container string
+	// EncryptionKey is the AES-256 key backups are sealed with.
+	EncryptionKey []byte
+	// Retention is how many backups are kept per node.
+	Retention int
+}
+
+type KubeconfigConfig struct {
+	// BarbicanEnabled also stores every generated kubeconfig as a Barbican
+	// secret in the cluster's project.
+	BarbicanEnabled bool
+	// BarbicanSecretPrefix is prepended to the Barbican secret names.
+	BarbicanSecretPrefix string
+	// DriftCheckInterval is how often the local kubeconfig is compared with
+	// the one VKE holds.
+	DriftCheckInterval time.Duration
+	// AdminCSREnabled uploads a dedicated admin credential issued through
+	// the CSR API instead of the node's own admin kubeconfig. Issued
+	// certificates cannot be revoked, so it is off unless opted into.
+	AdminCSREnabled bool
+	AdminUser       string
+	AdminGroups     []string
+	// AdminCertificateLifetime is the requested lifetime of the dedicated
+	// admin credential. The signer may cap it.
+	AdminCertificateLifetime time.Duration
+	// EncryptionEnabled envelope-encrypts the kubeconfig sent to VKE with
+	// EncryptionPublicKey. Uploads fail rather than fall back to plaintext
+	// when the key is missing.
+	EncryptionEnabled   bool
+	EncryptionPublicKey *rsa.PublicKey
+}
+
+// MetricsConfig is the HTTP endpoint serving the Prometheus metrics.
+type MetricsConfig struct {
+	// Address is the listen address, empty disables the endpoint.
+	Address string
+	// CertificateScanInterval is how often the expiry of the certificates on
+	// the local disk is read.
+	CertificateScanInterval time.Duration
+}
+
+// HealthConfig sets when the liveness and readiness endpoints served next to
+// the metrics start failing.
+type HealthConfig struct {
+	// HeartbeatTimeout is how long the check loop may go without a
+	// heartbeat before the agent is restarted.
+	HeartbeatTimeout time.Duration
+	// PhaseTimeout is how long a renewal phase may run before the agent is
+	// restarted. Waiting for workers to be allowed to restart is exempt.
+	PhaseTimeout time.Duration
+	// DependencyTimeout is how long Keystone or VKE may go without a
+	// successful call before the agent is not ready.
+	DependencyTimeout time.Duration
+}
+
+// EventsConfig controls the Kubernetes Events recorded for renewal and
+// restart steps.
+type EventsConfig struct {
+	// DedupInterval is how long an identical event on the same object is
+	// not recorded again.
+	DedupInterval time.Duration
+	// StatusConfigMapName is the ConfigMap in the agent's namespace that
+	// collects the step events of every node, so the whole cluster can be
+	// followed in one place.
+	StatusConfigMapName string
+}
+
+// ApprovalConfig makes control-plane renewals wait for a human approval
+// recorded on a ConfigMap.
+type ApprovalConfig struct {
+	Enabled bool
+	// ConfigMapName is the ConfigMap in the agent's namespace that holds the
+	// pending renewal and its approval.
+	ConfigMapName string
+	// Timeout is how long a pending renewal waits for approval before it
+	// escalates to the force tier.
+	Timeout time.Duration
 }
 
 func (a AgentConfig) IsProductionEnv() bool {
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// liveReloadKeys are the settings that can change while the agent runs.
+// Everything else, such as credentials, endpoints or the distribution, is
+// only read at startup.
+var liveReloadKeys = map[string]bool{
+	"LOG_VERBOSITY": true,
+	"VKE_APPLICATION_CREDENTIAL_EXPIRY_THRESHOLDS": true,
+	"RENEWAL_CHECK_INTERVAL":                       true,
+	"RENEWAL_VKE_CHECK_INTERVAL":                   true,
+	"RENEWAL_WARN_THRESHOLD":                       true,
+	"RENEWAL_MAINTENANCE_WINDOW":                   true,
+	"RENEWAL_FORCE_THRESHOLD":                      true,
+	"RENEWAL_MASTER_STAGGER":                       true,
+	"RENEWAL_ROLLOUT_POLL_INTERVAL":                true,
+	"LOADBALANCER_RECONCILE_INTERVAL":              true,
+	"LOADBALANCER_MEMBER_HEALTH_TIMEOUT":           true,
+	"LOADBALANCER_ALLOWED_CIDRS_DRY_RUN":           true,
+	"REMEDIATION_ENABLED":                          true,
+	"REMEDIATION_INTERVAL":                         true,
+	"REMEDIATION_NOT_READY_TIMEOUT":                true,
+	"REMEDIATION_MAX_ACTIONS":                      true,
+	"REMEDIATION_ACTION_WINDOW":                    true,
+	"REMEDIATION_MAX_UNHEALTHY_NODES":              true,
+	"NODE_IDENTITY_SYNC_INTERVAL":                  true,
+	"BACKUP_RETENTION":                             true,
+	"KUBECONFIG_DRIFT_CHECK_INTERVAL":              true,
+	"MAINTENANCE_TIMEZONE":                         true,
+	"MAINTENANCE_WINDOWS":                          true,
+	"MAINTENANCE_WINDOWS_MASTER_RENEWAL":           true,
+	"MAINTENANCE_WINDOWS_WORKER_RESTART":           true,
+	"MAINTENANCE_WINDOWS_REMEDIATION":              true,
+	"MAINTENANCE_FREEZE_PERIODS":                   true,
+	"MAINTENANCE_FREEZE_EMERGENCY_OVERRIDE":        true,
+	"MAINTENANCE_FREEZE_EMERGENCY_THRESHOLD":       true,
+	"MAINTENANCE_PAUSED":                           true,
+	"APPROVAL_ENABLED":                             true,
+	"APPROVAL_TIMEOUT":                             true,
+	"METRICS_CERTIFICATE_SCAN_INTERVAL":            true,
+	"HEALTH_HEARTBEAT_TIMEOUT":                     true,
+	"HEALTH_PHASE_TIMEOUT":                         true,
+	"HEALTH_DEPENDENCY_TIMEOUT":                    true,
+	"EVENTS_DEDUP_INTERVAL":                        true,
+}
+
+// liveConfig is the IConfigureManager handed out to the rest of the agent.
+// Reload swaps the configuration behind it in one step, so readers see
+// either the old or the new configuration, never a mix.
+type liveConfig struct {
+	mu      sync.RWMutex
+	current *configureManager
+}
+
+func newLiveConfig(manager *configureManager) *liveConfig {
+	return &liveConfig{current: manager}
+}
+
+func (l *liveConfig) get() *configureManager {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.current
+}
+
+// Reload applies overrides on top of the startup configuration. The result
+// is validated and only applied when it is valid and every changed setting
+// can be changed live. Empty overrides restore the startup configuration. It
+// returns the settings that changed.
+func Reload(overrides map[string]string) ([]string, error) {
+	live, ok := GlobalConfig.(*liveConfig)
+	if !ok {
+		return nil, fmt.Errorf("configuration does not support reloading")
+	}
+	return live.reload(overrides)
+}
+
+func (l *liveConfig) reload(overrides map[string]string) ([]string, error) {
+	normalized := make(map[string]string, len(overrides))
+	for key, value := range overrides {
+		normalized[strings.ToUpper(key)] = value
+	}
+
+	next, err := loadConfigureManager(func(key string) string {
+		if value, ok := normalized[key]; ok {
+			return value
+		}
+		return viper.GetString(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range normalized {
+		if _, known := next.rawSettings[key]; !known {
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var changed, rejected []string
+	for key, value := range next.rawSettings {
+		if l.current.rawSettings[key] == value {
+			continue
+		}
+		changed = append(changed, key)
+		if !liveReloadKeys[key] {
+			rejected = append(rejected, key)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(rejected)
+
+	if len(rejected) > 0 {
+		return nil, fmt.Errorf("settings %s cannot be changed without a restart", strings.Join(rejected, ", "))
+	}
+
+	l.current = next
+	return changed, nil
+}
+
+func (l *liveConfig) GetWebConfig() AgentConfig {
+	return l.get().GetWebConfig()
+}
+
+func (l *liveConfig) GetLanguageConfig() LanguageConfig {
+	return l.get().GetLanguageConfig()
+}
+
+func (l *liveConfig) GetVKEConfig() VKEConfig {
+	return l.get().GetVKEConfig()
+}
+
+func (l *liveConfig) GetRenewalConfig() RenewalConfig {
+	return l.get().GetRenewalConfig()
+}
+
+func (l *liveConfig) GetDistributionConfig() DistributionConfig {
+	return l.get().GetDistributionConfig()
+}
+
+func (l *liveConfig) GetLoadbalancerConfig() LoadbalancerConfig {
+	return l.get().GetLoadbalancerConfig()
+}
+
+func (l *liveConfig) GetRemediationConfig() RemediationConfig {
+	return l.get().GetRemediationConfig()
+}
+
+func (l *liveConfig) GetNodeIdentityConfig() NodeIdentityConfig {
+	return l.get().GetNodeIdentityConfig()
+}
+
+func (l *liveConfig) GetBackupConfig() BackupConfig {
+	return l.get().GetBackupConfig()
+}
+
+func (l *liveConfig) GetKubeconfigConfig() KubeconfigConfig {
+	return l.get().GetKubeconfigConfig()
+}
+
+func (l *liveConfig) GetMaintenanceConfig() MaintenanceConfig {
+	return l.get().GetMaintenanceConfig()
+}
+
+func (l *liveConfig) GetApprovalConfig() ApprovalConfig {
+	return l.get().GetApprovalConfig()
+}
+
+func (l *liveConfig) GetMetricsConfig() MetricsConfig {
+	return l.get().GetMetricsConfig()
+}
+
+func (l *liveConfig) GetHealthConfig() HealthConfig {
+	return l.get().GetHealthConfig()
+}
+
+func (l *liveConfig) GetEventsConfig() EventsConfig {
+	return l.get().GetEventsConfig()
+}
+
+func (l *liveConfig) GetSimulationConfig() SimulationConfig {
+	return l.get().GetSimulationConfig()
+}
+
+func (l *liveConfig) GetEffectiveSettings() map[string]string {
+	return l.get().GetEffectiveSettings()
+}
@@ -0,0 +1,313 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/pkg/maintenance"
+)
+
+const redacted = "<redacted>"
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	idPattern   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// ValidationError lists every problem found while loading the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// validator reads settings from viper, collects every problem instead of
+// stopping at the first one and remembers what it read so the effective
+// configuration can be printed.
+type validator struct {
+	source   func(key string) string
+	problems []string
+	settings map[string]string
+	secrets  map[string]bool
+}
+
+func newValidator(source func(key string) string) *validator {
+	return &validator{
+		source:   source,
+		settings: map[string]string{},
+		secrets:  map[string]bool{},
+	}
+}
+
+func (v *validator) addf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.Strings(v.problems)
+	return &ValidationError{Problems: v.problems}
+}
+
+// redactedSettings returns the settings read so far with secrets replaced.
+func (v *validator) redactedSettings() map[string]string {
+	result := make(map[string]string, len(v.settings))
+	for key, value := range v.settings {
+		if v.secrets[key] && value != "" {
+			value = redacted
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func (v *validator) string(key string) string {
+	value := strings.TrimSpace(v.source(key))
+	v.settings[key] = value
+	return value
+}
+
+func (v *validator) secret(key string) string {
+	v.secrets[key] = true
+	return v.string(key)
+}
+
+func (v *validator) required(key string) string {
+	value := v.string(key)
+	if value == "" {
+		v.addf(key, "is required")
+	}
+	return value
+}
+
+func (v *validator) requiredSecret(key string) string {
+	v.secrets[key] = true
+	return v.required(key)
+}
+
+func (v *validator) uuid(key string) string {
+	value := v.required(key)
+	if value != "" && !uuidPattern.MatchString(value) {
+		v.addf(key, "%q is not a UUID", value)
+	}
+	return value
+}
+
+func (v *validator) id(key string) string {
+	value := v.required(key)
+	if value != "" && !idPattern.MatchString(value) {
+		v.addf(key, "%q is not a valid ID", value)
+	}
+	return value
+}
+
+func (v *validator) url(key string) string {
+	value := v.required(key)
+	if value == "" {
+		return value
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.addf(key, "%q is not an http(s) URL", value)
+	}
+	return value
+}
+
+func (v *validator) oneOf(key string, allowed ...string) string {
+	value := strings.ToLower(v.string(key))
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	v.addf(key, "%q is not one of %s", value, strings.Join(allowed, ", "))
+	return value
+}
+
+func (v *validator) bool(key string) bool {
+	value := v.string(key)
+	if value == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.addf(key, "%q is not a boolean", value)
+	}
+	return b
+}
+
+func (v *validator) positiveInt(key string) int {
+	value := v.string(key)
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		v.addf(key, "%q is not a positive integer", value)
+	}
+	return i
+}
+
+// optionalInt reads an integer that may be left empty, which returns -1.
+func (v *validator) optionalInt(key string) int {
+	value := v.string(key)
+	if value == "" {
+		return -1
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		v.addf(key, "%q is not a non-negative integer", value)
+		return -1
+	}
+	return i
+}
+
+func (v *validator) duration(key string) time.Duration {
+	value := v.string(key)
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		v.addf(key, "%q is not a positive duration", value)
+	}
+	return d
+}
+
+// time reads an optional RFC 3339 timestamp or date.
+func (v *validator) time(key string) time.Time {
+	value := v.string(key)
+	if value == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	v.addf(key, "%q is not an RFC 3339 timestamp or a date", value)
+	return time.Time{}
+}
+
+// offset reads an optional signed duration that may start with a number of
+// days, e.g. +358d, -2d12h or 36h.
+func (v *validator) offset(key string) time.Duration {
+	value := v.string(key)
+	if value == "" {
+		return 0
+	}
+
+	sign := time.Duration(1)
+	rest := value
+	switch {
+	case strings.HasPrefix(rest, "+"):
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "-"):
+		sign, rest = -1, rest[1:]
+	}
+
+	var offset time.Duration
+	if i := strings.Index(rest, "d"); i >= 0 {
+		days, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			v.addf(key, "%q is not an offset such as +358d or 36h", value)
+			return 0
+		}
+		offset, rest = time.Duration(days)*24*time.Hour, rest[i+1:]
+	}
+
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			v.addf(key, "%q is not an offset such as +358d or 36h", value)
+			return 0
+		}
+		offset += d
+	}
+
+	return sign * offset
+}
+
+// location reads a time zone name such as Europe/Istanbul.
+func (v *validator) location(key string) *time.Location {
+	value := v.string(key)
+	location, err := time.LoadLocation(value)
+	if err != nil {
+		v.addf(key, "%q is not a time zone", value)
+		return time.UTC
+	}
+	return location
+}
+
+// windows reads maintenance windows separated by semicolons and reports
+// whether the setting was given at all.
+func (v *validator) windows(key string) ([]maintenance.Window, bool) {
+	value := v.string(key)
+	windows, err := maintenance.ParseList(value)
+	if err != nil {
+		v.addf(key, "%v", err)
+	}
+	return windows, value != ""
+}
+
+// freezes reads change freezes separated by semicolons. Dates are read in
+// location.
+func (v *validator) freezes(key string, location *time.Location) []maintenance.Freeze {
+	freezes, err := maintenance.ParseFreezeList(v.string(key), location)
+	if err != nil {
+		v.addf(key, "%v", err)
+	}
+	return freezes
+}
+
+// durationList reads a comma separated list of durations and returns it
+// sorted from the longest to the shortest.
+func (v *validator) durationList(key string) []time.Duration {
+	var durations []time.Duration
+	for _, item := range v.stringList(key) {
+		d, err := time.ParseDuration(item)
+		if err != nil || d <= 0 {
+			v.addf(key, "%q is not a positive duration", item)
+			continue
+		}
+		durations = append(durations, d)
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] > durations[j] })
+	return durations
+}
+
+// stringList reads a comma separated list and drops empty items.
+func (v *validator) stringList(key string) []string {
+	var result []string
+	for _, item := range strings.Split(v.string(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// FormatSettings renders settings as a YAML document in the config file
+// format, sorted by key.
+func FormatSettings(settings map[string]string) string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", key, strconv.Quote(settings[key]))
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidatorOffset(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"36h", 36 * time.Hour},
+		{"+358d", 358 * 24 * time.Hour},
+		{"-2d12h", -60 * time.Hour},
+		{"1d30m", 24*time.Hour + 30*time.Minute},
+		{" -90m ", -90 * time.Minute},
+	}
+	for _, tt := range tests {
+		v := newValidator(func(string) string { return tt.value })
+		if got := v.offset("OFFSET"); got != tt.want {
+			t.Errorf("offset(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+		if err := v.err(); err != nil {
+			t.Errorf("offset(%q): %v", tt.value, err)
+		}
+	}
+}
+
+func TestValidatorOffsetInvalid(t *testing.T) {
+	for _, value := range []string{"358", "xd", "+d", "2d-1h", "--1h", "1w"} {
+		v := newValidator(func(string) string { return value })
+		if got := v.offset("OFFSET"); got != 0 {
+			t.Errorf("offset(%q) = %s, want 0", value, got)
+		}
+		if v.err() == nil {
+			t.Errorf("offset(%q) succeeded, want an error", value)
+		}
+	}
+}
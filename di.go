@@ -1,13 +1,85 @@
 package di
 
 import (
+	"os"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
 	"github.com/vmindtech/vke-cluster-agent/internal/service"
+	"github.com/vmindtech/vke-cluster-agent/pkg/clock"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/events"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 )
 
 func InitAppService(k8sClient *kubernetes.Clientset, k8sConfig *rest.Config) service.IAppService {
 	openstackService := service.NewOpenstackService()
 	vkeService := service.NewVKEService()
-	return service.NewAppService(openstackService, vkeService, k8sClient, k8sConfig)
+	loadbalancerService := service.NewLoadbalancerService()
+	computeService := service.NewComputeService()
+	metadataService := service.NewMetadataService()
+	backupService := InitBackupService()
+	keyManagerService := service.NewKeyManagerService()
+	networkService := service.NewNetworkService()
+	distribution := initDistribution(k8sClient)
+	eventRecorder := newEventRecorder(k8sClient)
+	return service.NewAppService(openstackService, vkeService, loadbalancerService, computeService, metadataService, backupService, keyManagerService, networkService, distribution, initClock(), k8sClient, k8sConfig, eventRecorder)
+}
+
+// initClock returns the real clock unless a simulation is configured.
+func initClock() clock.Clock {
+	simulationConfig := config.GlobalConfig.GetSimulationConfig()
+	switch {
+	case !simulationConfig.Time.IsZero():
+		klog.Warningf("Simulating decision time starting at %s, dates sent to VKE use the real time", simulationConfig.Time.Format(time.RFC3339))
+		return clock.NewSimulatedClock(simulationConfig.Time)
+	case simulationConfig.Offset != 0:
+		klog.Warningf("Simulating decision time offset by %s, dates sent to VKE use the real time", simulationConfig.Offset)
+		return clock.NewOffsetClock(simulationConfig.Offset)
+	default:
+		return clock.NewRealClock()
+	}
+}
+
+// initDistribution picks the configured distribution. When it cannot be
+// detected the agent keeps managing the node as RKE2, as it always did.
+func initDistribution(k8sClient *kubernetes.Clientset) service.IDistribution {
+	name := config.GlobalConfig.GetDistributionConfig().Name
+	distribution, err := service.NewDistribution(name, k8sClient)
+	if err != nil {
+		klog.ErrorS(err, "Failed to select distribution, falling back to RKE2",
+			"distribution", name,
+			"component", "startup")
+		distribution, _ = service.NewDistribution(constants.DistributionRKE2, k8sClient)
+	}
+
+	klog.V(0).InfoS("Managing node distribution",
+		"distribution", distribution.Name(),
+		"component", "startup")
+	return distribution
+}
+
+func InitBackupService() service.IBackupService {
+	objectStorageService := service.NewObjectStorageService()
+	return service.NewBackupService(objectStorageService)
+}
+
+// newEventRecorder returns a recorder that drops events repeated within
+// EVENTS_DEDUP_INTERVAL.
+func newEventRecorder(k8sClient *kubernetes.Clientset) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{
+		Component: constants.EventSourceComponent,
+		Host:      os.Getenv("NODE_NAME"),
+	})
+	return events.NewDeduplicatingRecorder(recorder, func() time.Duration {
+		return config.GlobalConfig.GetEventsConfig().DedupInterval
+	})
 }
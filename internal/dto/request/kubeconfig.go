@@ -0,0 +1,29 @@
+package request
+
+import "time"
+
+type UpdateKubeconfigRequest struct {
+	Kubeconfig        string                  `json:"kubeconfig"`
+	BarbicanSecretRef string                  `json:"barbican_secret_ref,omitempty"`
+	Encryption        *KubeconfigEncryption   `json:"encryption,omitempty"`
+	Fingerprints      *KubeconfigFingerprints `json:"fingerprints,omitempty"`
+}
+
+// KubeconfigEncryption describes how Kubeconfig was sealed when it is
+// envelope-encrypted. Kubeconfig then holds the base64 of the AES-GCM nonce
+// followed by the ciphertext.
+type KubeconfigEncryption struct {
+	Algorithm    string `json:"algorithm"`
+	KeyID        string `json:"key_id"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+// KubeconfigFingerprints identifies the credentials inside an encrypted
+// kubeconfig without exposing them.
+type KubeconfigFingerprints struct {
+	CA                string    `json:"ca_sha256"`
+	ClientCertificate string    `json:"client_certificate_sha256"`
+	ClientUser        string    `json:"client_user"`
+	ClientNotBefore   time.Time `json:"client_not_before"`
+	ClientNotAfter    time.Time `json:"client_not_after"`
+}
@@ -8,4 +8,6 @@ type UpdateClusterRequest struct {
 	ClusterStatus                string    `json:"cluster_status"`
 	ClusterAPIAccess             string    `json:"cluster_api_access"`
 	ClusterCertificateExpireDate time.Time `json:"cluster_certificate_expire_date"`
+
+	ClusterApplicationCredentialExpireDate *time.Time `json:"cluster_application_credential_expire_date,omitempty"`
 }
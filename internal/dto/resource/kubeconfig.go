@@ -0,0 +1,26 @@
+package resource
+
+import "time"
+
+type VKEKubeconfigResponse struct {
+	Data struct {
+		ClusterUUID  string                  `json:"cluster_uuid"`
+		Kubeconfig   string                  `json:"kubeconfig"`
+		Encryption   *KubeconfigEncryption   `json:"encryption,omitempty"`
+		Fingerprints *KubeconfigFingerprints `json:"fingerprints,omitempty"`
+	} `json:"data"`
+}
+
+type KubeconfigEncryption struct {
+	Algorithm    string `json:"algorithm"`
+	KeyID        string `json:"key_id"`
+	EncryptedKey string `json:"encrypted_key"`
+}
+
+type KubeconfigFingerprints struct {
+	CA                string    `json:"ca_sha256"`
+	ClientCertificate string    `json:"client_certificate_sha256"`
+	ClientUser        string    `json:"client_user"`
+	ClientNotBefore   time.Time `json:"client_not_before"`
+	ClientNotAfter    time.Time `json:"client_not_after"`
+}
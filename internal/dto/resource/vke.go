@@ -15,6 +15,13 @@ type NodeGroup struct {
 	NodeGroupsStatus string `json:"node_groups_status"`
 }
 
+// FreezePeriod is a change freeze announced by VKE for the cluster.
+type FreezePeriod struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
 type VKEClusterResponse struct {
 	Data struct {
 		ClusterUUID                  string      `json:"cluster_uuid"`
@@ -29,5 +36,8 @@ type VKEClusterResponse struct {
 		ClusterEndpoint              string      `json:"cluster_endpoint"`
 		ClusterAPIAccess             string      `json:"cluster_api_access"`
 		ClusterCertificateExpireDate time.Time   `json:"cluster_certificate_expire_date"`
+
+		ClusterApplicationCredentialExpireDate *time.Time     `json:"cluster_application_credential_expire_date"`
+		ClusterFreezePeriods                   []FreezePeriod `json:"cluster_freeze_periods"`
 	} `json:"data"`
 }
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// BackupManifest describes the content of a TLS backup archive.
+type BackupManifest struct {
+	ClusterID    string                   `json:"cluster_id"`
+	NodeName     string                   `json:"node_name"`
+	CreatedAt    time.Time                `json:"created_at"`
+	Certificates []CertificateFingerprint `json:"certificates"`
+}
+
+type CertificateFingerprint struct {
+	File      string    `json:"file"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA256    string    `json:"sha256"`
+}
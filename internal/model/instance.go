@@ -0,0 +1,12 @@
+package model
+
+// InstanceMetadata is the subset of the OpenStack meta_data.json document the
+// agent uses to identify the instance it runs on.
+type InstanceMetadata struct {
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	Hostname         string            `json:"hostname"`
+	AvailabilityZone string            `json:"availability_zone"`
+	ProjectID        string            `json:"project_id"`
+	Meta             map[string]string `json:"meta"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// RenewalDecision is what the certificate check decided from the expiry
+// reported by VKE. Tier is one of the constants.RenewalTier* names.
+type RenewalDecision struct {
+	Tier       string
+	Reason     string
+	ExpireDate time.Time
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"k8s.io/klog/v2"
+)
+
+// reconcileAllowedCIDRs treats ClusterAPIAccess as the desired allowed_cidrs
+// of the API listener and reports and corrects any drift. An empty
+// ClusterAPIAccess means no restriction, so the listener's allowed_cidrs are
+// cleared. Nodes reach the API through the load balancer as well, so a
+// restriction always keeps the cluster subnets allowed.
+func (a *appService) reconcileAllowedCIDRs(providerClient *gophercloud.ProviderClient, cluster *resource.VKEClusterResponse) error {
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	region := config.GlobalConfig.GetVKEConfig().Region
+	dryRun := config.GlobalConfig.GetLoadbalancerConfig().AllowedCIDRsDryRun
+
+	desired, err := parseCIDRList(cluster.Data.ClusterAPIAccess)
+	if err != nil {
+		return fmt.Errorf("invalid cluster api access %q: %v", cluster.Data.ClusterAPIAccess, err)
+	}
+
+	if len(desired) > 0 {
+		subnetCIDRs, err := a.clusterSubnetCIDRs(providerClient, cluster)
+		if err != nil {
+			return err
+		}
+		desired, err = parseCIDRList(strings.Join(append(desired, subnetCIDRs...), ","))
+		if err != nil {
+			return fmt.Errorf("invalid cluster subnet cidrs %v: %v", subnetCIDRs, err)
+		}
+	}
+
+	lbListeners, err := a.iLoadbalancerService.ListListeners(providerClient, region, cluster.Data.ClusterLoadbalancerUUID)
+	if err != nil {
+		return fmt.Errorf("failed to list listeners: %v", err)
+	}
+
+	for _, listener := range lbListeners {
+		if listener.ProtocolPort != constants.KubeAPIServerPort {
+			continue
+		}
+
+		current, err := parseCIDRList(strings.Join(listener.AllowedCIDRs, ","))
+		if err != nil {
+			return fmt.Errorf("listener %s has invalid allowed cidrs: %v", listener.ID, err)
+		}
+
+		added, removed := diffStrings(current, desired)
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		klog.Warningf("API access drift detected - cluster_id: %s, listener_id: %s, missing: %v, unexpected: %v, dry_run: %t",
+			clID, listener.ID, added, removed, dryRun)
+
+		if dryRun {
+			klog.V(0).InfoS("Dry run, not updating listener allowed cidrs",
+				"cluster_id", clID,
+				"listener_id", listener.ID,
+				"current", current,
+				"desired", desired,
+				"component", "api_access_enforcer")
+			continue
+		}
+
+		if err := a.waitForLoadbalancerActive(providerClient, cluster.Data.ClusterLoadbalancerUUID); err != nil {
+			return err
+		}
+		if _, err := a.iLoadbalancerService.UpdateListenerAllowedCIDRs(providerClient, region, listener.ID, desired); err != nil {
+			return err
+		}
+
+		klog.V(0).InfoS("Listener allowed cidrs updated",
+			"cluster_id", clID,
+			"listener_id", listener.ID,
+			"allowed_cidrs", desired,
+			"component", "api_access_enforcer")
+	}
+
+	return nil
+}
+
+// clusterSubnetCIDRs returns the CIDRs of the cluster's subnets.
+func (a *appService) clusterSubnetCIDRs(providerClient *gophercloud.ProviderClient, cluster *resource.VKEClusterResponse) ([]string, error) {
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	var cidrs []string
+	for _, subnetID := range cluster.Data.ClusterSubnets {
+		subnet, err := a.iNetworkService.GetSubnet(providerClient, region, subnetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cluster subnet %s: %v", subnetID, err)
+		}
+		cidrs = append(cidrs, subnet.CIDR)
+	}
+	return cidrs, nil
+}
+
+// parseCIDRList parses a comma, semicolon or whitespace separated list of
+// CIDRs. Bare addresses are turned into host routes. The result is normalized,
+// de-duplicated and sorted.
+func parseCIDRList(raw string) ([]string, error) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	})
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, field := range fields {
+		if !strings.Contains(field, "/") {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", field)
+			}
+			if ip.To4() != nil {
+				field += "/32"
+			} else {
+				field += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", field)
+		}
+
+		cidr := ipNet.String()
+		if !seen[cidr] {
+			seen[cidr] = true
+			result = append(result, cidr)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// diffStrings returns the items of desired missing from current and the items
+// of current that are not desired.
+func diffStrings(current, desired []string) (added, removed []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, item := range current {
+		currentSet[item] = true
+	}
+
+	desiredSet := make(map[string]bool, len(desired))
+	for _, item := range desired {
+		desiredSet[item] = true
+		if !currentSet[item] {
+			added = append(added, item)
+		}
+	}
+
+	for _, item := range current {
+		if !desiredSet[item] {
+			removed = append(removed, item)
+		}
+	}
+
+	return added, removed
+}
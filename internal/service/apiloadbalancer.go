@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	loadbalancerPollInterval  = 10 * time.Second
+	loadbalancerActiveTimeout = 5 * time.Minute
+)
+
+type controlPlanePool struct {
+	ID   string
+	Port int
+}
+
+// ReconcileLoadbalancer makes the API load balancer match the desired state:
+// its pools contain exactly the current control-plane nodes and its API
+// listener only accepts ClusterAPIAccess. Only the first master acts, so the
+// load balancer is not changed by several agents at once, and nothing is
+// changed while the agent is paused.
+func (a *appService) ReconcileLoadbalancer() error {
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+
+	isFirstMaster, err := a.isFirstMasterNode()
+	if err != nil {
+		return err
+	}
+
+	if !isFirstMaster {
+		return nil
+	}
+
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+	if a.checkPaused(constants.ActionLoadbalancerReconcile, currentNode) != nil {
+		return nil
+	}
+
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return fmt.Errorf("failed to get openstack session: %v", err)
+	}
+
+	cluster, err := a.iVKEClusterService.GetCluster(clID, providerClient.Token(), config.GlobalConfig.GetVKEConfig().VKEURL)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster: %v", err)
+	}
+
+	lbID := cluster.Data.ClusterLoadbalancerUUID
+	if lbID == "" {
+		klog.V(2).InfoS("Cluster has no API load balancer, skipping member reconciliation",
+			"cluster_id", clID,
+			"component", "loadbalancer_reconciler")
+		return nil
+	}
+
+	masters, err := getMasterNodes(a.k8sClient)
+	if err != nil {
+		return err
+	}
+
+	desired := nodeInternalAddresses(masters)
+	if len(desired) == 0 {
+		return fmt.Errorf("no control-plane node addresses found")
+	}
+
+	controlPlanePools, err := a.getControlPlanePools(providerClient, lbID)
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range controlPlanePools {
+		if err := a.reconcilePoolMembers(providerClient, cluster, pool, desired); err != nil {
+			return fmt.Errorf("failed to reconcile pool %s: %v", pool.ID, err)
+		}
+	}
+
+	if err := a.reconcileAllowedCIDRs(providerClient, cluster); err != nil {
+		return fmt.Errorf("failed to enforce cluster api access: %v", err)
+	}
+
+	klog.V(2).InfoS("API load balancer reconciled",
+		"cluster_id", clID,
+		"loadbalancer_id", lbID,
+		"pools", len(controlPlanePools),
+		"component", "loadbalancer_reconciler")
+
+	return nil
+}
+
+func (a *appService) getControlPlanePools(providerClient *gophercloud.ProviderClient, lbID string) ([]controlPlanePool, error) {
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	lbListeners, err := a.iLoadbalancerService.ListListeners(providerClient, region, lbID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listeners: %v", err)
+	}
+
+	var result []controlPlanePool
+	for _, listener := range lbListeners {
+		if listener.DefaultPoolID == "" || !containsPort(a.distribution.ControlPlanePorts(), listener.ProtocolPort) {
+			continue
+		}
+		result = append(result, controlPlanePool{ID: listener.DefaultPoolID, Port: listener.ProtocolPort})
+	}
+
+	return result, nil
+}
+
+// reconcilePoolMembers adds the missing control-plane members to pool before
+// it removes stale ones, so the pool is never emptied on the way. Stale
+// members are only removed when at least one existing member matches a
+// control-plane address, a mismatch such as nodes reporting another
+// interface would otherwise remove every member, and the last ONLINE member
+// is never removed.
+func (a *appService) reconcilePoolMembers(providerClient *gophercloud.ProviderClient, cluster *resource.VKEClusterResponse, pool controlPlanePool, desired map[string]string) error {
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	region := config.GlobalConfig.GetVKEConfig().Region
+	lbID := cluster.Data.ClusterLoadbalancerUUID
+
+	members, err := a.iLoadbalancerService.ListPoolMembers(providerClient, region, pool.ID)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool)
+	var stale []pools.Member
+	online := 0
+	for _, member := range members {
+		if member.OperatingStatus == constants.MemberOperatingStatusOnline {
+			online++
+		}
+		if _, ok := desired[member.Address]; ok && member.ProtocolPort == pool.Port {
+			present[member.Address] = true
+			continue
+		}
+		stale = append(stale, member)
+	}
+
+	var subnetID string
+	if len(cluster.Data.ClusterSubnets) > 0 {
+		subnetID = cluster.Data.ClusterSubnets[0]
+	}
+
+	for address, nodeName := range desired {
+		if present[address] {
+			continue
+		}
+
+		klog.V(0).InfoS("Adding missing API load balancer member",
+			"cluster_id", clID,
+			"pool_id", pool.ID,
+			"node", nodeName,
+			"address", address,
+			"port", pool.Port,
+			"component", "loadbalancer_reconciler")
+
+		if err := a.waitForLoadbalancerActive(providerClient, lbID); err != nil {
+			return err
+		}
+		if _, err := a.iLoadbalancerService.CreatePoolMember(providerClient, region, pool.ID, pools.CreateMemberOpts{
+			Name:         nodeName,
+			Address:      address,
+			ProtocolPort: pool.Port,
+			SubnetID:     subnetID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+	if len(present) == 0 {
+		return fmt.Errorf("none of the %d members of pool %s matches a control-plane node address, refusing to remove any", len(members), pool.ID)
+	}
+
+	for _, member := range stale {
+		if member.OperatingStatus == constants.MemberOperatingStatusOnline && online <= 1 {
+			klog.Warningf("Keeping stale API load balancer member, it is the last ONLINE one - pool_id: %s, member_id: %s, address: %s",
+				pool.ID, member.ID, member.Address)
+			continue
+		}
+
+		klog.V(0).InfoS("Removing stale API load balancer member",
+			"cluster_id", clID,
+			"pool_id", pool.ID,
+			"member_id", member.ID,
+			"address", member.Address,
+			"port", member.ProtocolPort,
+			"component", "loadbalancer_reconciler")
+
+		if err := a.waitForLoadbalancerActive(providerClient, lbID); err != nil {
+			return err
+		}
+		if err := a.iLoadbalancerService.DeletePoolMember(providerClient, region, pool.ID, member.ID); err != nil {
+			return err
+		}
+		if member.OperatingStatus == constants.MemberOperatingStatusOnline {
+			online--
+		}
+	}
+
+	return nil
+}
+
+// checkLoadbalancerHealthMonitors fails when a control-plane pool of the API
+// load balancer has no health monitor. Member health cannot be verified
+// without one, so renewals check it before they restart the server rather
+// than fail once the node is already disrupted.
+func (a *appService) checkLoadbalancerHealthMonitors(cluster *resource.VKEClusterResponse) error {
+	lbID := cluster.Data.ClusterLoadbalancerUUID
+	if lbID == "" {
+		return nil
+	}
+
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return fmt.Errorf("failed to get openstack session: %v", err)
+	}
+
+	controlPlanePools, err := a.getControlPlanePools(providerClient, lbID)
+	if err != nil {
+		return err
+	}
+
+	for _, controlPlanePool := range controlPlanePools {
+		pool, err := a.iLoadbalancerService.GetPool(providerClient, region, controlPlanePool.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get pool %s: %v", controlPlanePool.ID, err)
+		}
+		if pool.MonitorID == "" {
+			return fmt.Errorf("pool %s of port %d has no health monitor, member health cannot be verified", pool.ID, controlPlanePool.Port)
+		}
+	}
+
+	return nil
+}
+
+// waitForHealthyLoadbalancerMembers blocks until the API load balancer reports
+// every given node as a healthy member on all control-plane ports. Clusters
+// without a load balancer are not waited on.
+func (a *appService) waitForHealthyLoadbalancerMembers(cluster *resource.VKEClusterResponse, nodes []v1.Node) error {
+	lbID := cluster.Data.ClusterLoadbalancerUUID
+	if lbID == "" || len(nodes) == 0 {
+		return nil
+	}
+
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	region := config.GlobalConfig.GetVKEConfig().Region
+	addresses := nodeInternalAddresses(nodes)
+
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return fmt.Errorf("failed to get openstack session: %v", err)
+	}
+
+	controlPlanePools, err := a.getControlPlanePools(providerClient, lbID)
+	if err != nil {
+		return err
+	}
+
+	klog.V(2).InfoS("Waiting for API load balancer members to become healthy",
+		"cluster_id", clID,
+		"loadbalancer_id", lbID,
+		"members", len(addresses),
+		"component", "loadbalancer_reconciler")
+
+	err = wait.PollUntilContextTimeout(context.Background(), loadbalancerPollInterval, config.GlobalConfig.GetLoadbalancerConfig().MemberHealthTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			for _, pool := range controlPlanePools {
+				members, err := a.iLoadbalancerService.ListPoolMembers(providerClient, region, pool.ID)
+				if err != nil {
+					return false, nil
+				}
+
+				for address, nodeName := range addresses {
+					status := memberOperatingStatus(members, address, pool.Port)
+					if status == constants.MemberOperatingStatusNoMonitor {
+						return false, fmt.Errorf("pool %s has no health monitor, member health cannot be verified", pool.ID)
+					}
+					if status != constants.MemberOperatingStatusOnline {
+						klog.V(4).InfoS("API load balancer member not healthy yet",
+							"cluster_id", clID,
+							"pool_id", pool.ID,
+							"node", nodeName,
+							"address", address,
+							"status", status,
+							"component", "loadbalancer_reconciler")
+						return false, nil
+					}
+				}
+			}
+			return true, nil
+		})
+	if err != nil {
+		return fmt.Errorf("api load balancer members did not become healthy: %v", err)
+	}
+
+	return nil
+}
+
+func (a *appService) waitForLoadbalancerActive(providerClient *gophercloud.ProviderClient, lbID string) error {
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	err := wait.PollUntilContextTimeout(context.Background(), loadbalancerPollInterval, loadbalancerActiveTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			lb, err := a.iLoadbalancerService.GetLoadbalancer(providerClient, region, lbID)
+			if err != nil {
+				return false, nil
+			}
+
+			switch lb.ProvisioningStatus {
+			case constants.LoadbalancerProvisioningStatusActive:
+				return true, nil
+			case constants.LoadbalancerProvisioningStatusError:
+				return false, fmt.Errorf("load balancer %s is in %s state", lbID, lb.ProvisioningStatus)
+			}
+			return false, nil
+		})
+	if err != nil {
+		return fmt.Errorf("load balancer %s did not become active: %v", lbID, err)
+	}
+
+	return nil
+}
+
+// memberOperatingStatus returns the operating status of the pool member for
+// the address and port, empty when there is none. Only ONLINE counts as
+// healthy; members of a pool without a health monitor report NO_MONITOR and
+// say nothing about whether the node serves.
+func memberOperatingStatus(members []pools.Member, address string, port int) string {
+	for _, member := range members {
+		if member.Address == address && member.ProtocolPort == port {
+			return member.OperatingStatus
+		}
+	}
+	return ""
+}
+
+// nodeInternalAddresses maps the InternalIP of every node to its name.
+func nodeInternalAddresses(nodes []v1.Node) map[string]string {
+	addresses := make(map[string]string)
+	for _, node := range nodes {
+		for _, address := range node.Status.Addresses {
+			if address.Type == v1.NodeInternalIP {
+				addresses[address.Address] = node.Name
+				break
+			}
+		}
+	}
+	return addresses
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
@@ -3,45 +3,79 @@ package service
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/vmindtech/vke-cluster-agent/config"
 	"github.com/vmindtech/vke-cluster-agent/internal/dto/request"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
 	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/clock"
 	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
-	"gopkg.in/yaml.v2"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 )
 
 type IAppService interface {
 	GetOpenstackSession(pjID, applicationCredentialID, applicationCredentialSecret, identityURL string) (*gophercloud.ProviderClient, error)
-	CheckVKEClusterCertificateExpiration(isExpired chan bool)
-	RenewMasterNodesCertificates() error
-	RestartWorkerNodes() error
+	CheckVKEClusterCertificateExpiration(decisions chan<- model.RenewalDecision)
+	RenewMasterNodesCertificates(decision model.RenewalDecision) error
+	FollowRollout() error
+	ReconcileLoadbalancer() error
+	RemediateNotReadyNodes() error
+	SyncNodeIdentity() error
+	SyncKubeconfig() error
+	RecordCertificateExpiry() error
+	WatchConfigMap(stopCh <-chan struct{})
 }
 
 type appService struct {
-	iOpenstackService  IOpenstackService
-	iVKEClusterService IVKEService
-	k8sClient          *kubernetes.Clientset
-	k8sConfig          *rest.Config
+	iOpenstackService    IOpenstackService
+	iVKEClusterService   IVKEService
+	iLoadbalancerService ILoadbalancerService
+	iComputeService      IComputeService
+	iMetadataService     IMetadataService
+	iBackupService       IBackupService
+	iKeyManagerService   IKeyManagerService
+	iNetworkService      INetworkService
+	distribution         IDistribution
+	clock                clock.Clock
+	schedule             vkeSchedule
+	status               stepStatus
+	attempt              rolloutAttempt
+	credentialWarning    credentialWarning
+	k8sClient            kubernetes.Interface
+	k8sConfig            *rest.Config
+	eventRecorder        record.EventRecorder
 }
 
-func NewAppService(iOpenstackService IOpenstackService, iVKEClusterService IVKEService, k8sClient *kubernetes.Clientset, k8sConfig *rest.Config) IAppService {
+func NewAppService(iOpenstackService IOpenstackService, iVKEClusterService IVKEService, iLoadbalancerService ILoadbalancerService, iComputeService IComputeService, iMetadataService IMetadataService, iBackupService IBackupService, iKeyManagerService IKeyManagerService, iNetworkService INetworkService, distribution IDistribution, clock clock.Clock, k8sClient kubernetes.Interface, k8sConfig *rest.Config, eventRecorder record.EventRecorder) IAppService {
 	return &appService{
-		iOpenstackService:  iOpenstackService,
-		iVKEClusterService: iVKEClusterService,
-		k8sClient:          k8sClient,
-		k8sConfig:          k8sConfig,
+		iOpenstackService:    iOpenstackService,
+		iVKEClusterService:   iVKEClusterService,
+		iLoadbalancerService: iLoadbalancerService,
+		iComputeService:      iComputeService,
+		iMetadataService:     iMetadataService,
+		iBackupService:       iBackupService,
+		iKeyManagerService:   iKeyManagerService,
+		iNetworkService:      iNetworkService,
+		distribution:         distribution,
+		clock:                clock,
+		k8sClient:            k8sClient,
+		k8sConfig:            k8sConfig,
+		eventRecorder:        eventRecorder,
 	}
 }
 
@@ -49,66 +83,92 @@ func (a *appService) GetOpenstackSession(pjID, applicationCredentialID, applicat
 	return a.iOpenstackService.ValidateAndCreateSession(pjID, applicationCredentialID, applicationCredentialSecret, identityURL)
 }
 
-func (a *appService) CheckVKEClusterCertificateExpiration(isExpired chan bool) {
+// CheckVKEClusterCertificateExpiration checks the certificate expiry in VKE
+// every RENEWAL_VKE_CHECK_INTERVAL, for as long as the agent runs, and sends
+// the decisions that need a renewal. A decision is dropped while an earlier
+// one is still waiting in decisions, the next check sends it again.
+func (a *appService) CheckVKEClusterCertificateExpiration(decisions chan<- model.RenewalDecision) {
+	for {
+		health.Heartbeat()
+		a.checkVKEClusterCertificateExpiration(decisions)
+		time.Sleep(config.GlobalConfig.GetRenewalConfig().VKECheckInterval)
+	}
+}
+
+// checkVKEClusterCertificateExpiration runs a single check. Errors are
+// logged and the check is retried on the next interval.
+func (a *appService) checkVKEClusterCertificateExpiration(decisions chan<- model.RenewalDecision) {
 	clID := config.GlobalConfig.GetVKEConfig().ClusterID
 	vkeURL := config.GlobalConfig.GetVKEConfig().VKEURL
 
-	var getCurrentTime func() time.Time
-	if config.GlobalConfig.GetIsTestMode() {
-		getCurrentTime = func() time.Time {
-			return time.Now().AddDate(0, 0, 359)
-		}
-	} else {
-		getCurrentTime = time.Now
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		klog.ErrorS(err, "Failed to get token",
+			"cluster_id", clID,
+			"component", "certificate_checker")
+		return
 	}
+	token := providerClient.Token()
 
-	for {
-		token := a.getLatestToken()
-		if token == "" {
-			klog.ErrorS(nil, "Failed to get token",
-				"cluster_id", clID,
-				"component", "certificate_checker")
-			return
-		}
+	klog.V(2).InfoS("Token refreshed successfully",
+		"cluster_id", clID,
+		"component", "certificate_checker")
 
-		klog.V(2).InfoS("Token refreshed successfully",
+	getClusterResponse, err := a.iVKEClusterService.GetCluster(clID, token, vkeURL)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get cluster info",
 			"cluster_id", clID,
+			"vke_url", vkeURL,
 			"component", "certificate_checker")
+		return
+	}
 
-		getClusterResponse, err := a.iVKEClusterService.GetCluster(clID, token, vkeURL)
-		if err != nil {
-			klog.ErrorS(err, "Failed to get cluster info",
-				"cluster_id", clID,
-				"vke_url", vkeURL,
-				"component", "certificate_checker")
-			return
-		}
+	klog.V(2).InfoS("Retrieved cluster information",
+		"cluster_id", clID,
+		"component", "certificate_checker")
 
-		klog.V(2).InfoS("Retrieved cluster information",
+	a.checkApplicationCredentialExpiration(providerClient, getClusterResponse)
+
+	metrics.SetLastSuccessfulCheck(time.Now())
+	metrics.SetCertificateExpiry(metrics.SourceVKE, "cluster", getClusterResponse.Data.ClusterCertificateExpireDate)
+	a.rememberVKESchedule(getClusterResponse)
+
+	decision := decideRenewal(a.clock.DecisionTime(), getClusterResponse.Data.ClusterCertificateExpireDate, config.GlobalConfig.GetRenewalConfig())
+	if err := a.recordRenewalTier(decision); err != nil {
+		klog.ErrorS(err, "Failed to record renewal tier",
 			"cluster_id", clID,
 			"component", "certificate_checker")
+	}
 
-		if IsExpired(getCurrentTime(), getClusterResponse.Data.ClusterCertificateExpireDate, constants.OneWeekMaintenanceWindow) {
-			klog.V(0).InfoS("Certificate expiration detected",
+	switch decision.Tier {
+	case constants.RenewalTierWarn:
+		klog.Warningf("Certificates expire soon - tier: %s, reason: %s", decision.Tier, decision.Reason)
+	case constants.RenewalTierSchedule, constants.RenewalTierForce:
+		klog.V(0).InfoS("Certificate expiration detected",
+			"cluster_id", clID,
+			"expire_date", getClusterResponse.Data.ClusterCertificateExpireDate,
+			"tier", decision.Tier,
+			"reason", decision.Reason,
+			"decision_time", a.clock.DecisionTime(),
+			"simulated", a.clock.Simulated(),
+			"component", "certificate_checker")
+		select {
+		case decisions <- decision:
+		default:
+			klog.V(2).InfoS("Previous renewal decision still pending, dropping this one",
 				"cluster_id", clID,
-				"expire_date", getClusterResponse.Data.ClusterCertificateExpireDate,
 				"component", "certificate_checker")
-			isExpired <- true
 		}
-
-		time.Sleep(constants.VKECheckCertificateExpirationInterval)
 	}
 }
 
-func (a *appService) RenewMasterNodesCertificates() error {
-	var getCurrentTime func() time.Time
-	if config.GlobalConfig.GetIsTestMode() {
-		getCurrentTime = func() time.Time {
-			return time.Now().AddDate(0, 0, 359)
-		}
-	} else {
-		getCurrentTime = time.Now
-	}
+// RenewMasterNodesCertificates starts the control-plane rollout on the first
+// master: it renews the first master and records the rollout the other
+// masters follow. Unless decision is in the force tier, the rollout only
+// starts when maintenance windows and change freezes allow it.
+func (a *appService) RenewMasterNodesCertificates(decision model.RenewalDecision) error {
+	defer setRenewalPhase(constants.RenewalPhaseIdle)
+	renewalConfig := config.GlobalConfig.GetRenewalConfig()
 
 	clID := config.GlobalConfig.GetVKEConfig().ClusterID
 	cluster, err := a.iVKEClusterService.GetCluster(clID, a.getLatestToken(), config.GlobalConfig.GetVKEConfig().VKEURL)
@@ -119,90 +179,198 @@ func (a *appService) RenewMasterNodesCertificates() error {
 	if cluster.Data.ClusterStatus != constants.ClusterStatusActive {
 		return fmt.Errorf("cluster is not active")
 	}
+	a.rememberVKESchedule(cluster)
 
 	currentNode, err := getCurrentNode(a.k8sClient)
 	if err != nil {
 		return fmt.Errorf("failed to get current node: %v", err)
 	}
 
-	if !isMasterNode(currentNode) {
+	if !a.distribution.IsControlPlane(currentNode) {
 		return nil
 	}
 
-	firstMaster, err := getFirstMasterNode(a.k8sClient)
+	masters, err := getMasterNodes(a.k8sClient)
 	if err != nil {
 		return fmt.Errorf("failed to determine first master node: %v", err)
 	}
 
-	isFirstMaster := currentNode.Name == firstMaster.Name
-	isOtherMaster := !isFirstMaster && isMasterNode(currentNode)
+	// The other masters renew when the rollout recorded by the first master
+	// reaches them, see FollowRollout.
+	if masters[0].Name != currentNode.Name {
+		return nil
+	}
+
+	if err := a.checkPaused(constants.ActionMasterRenewal, currentNode); err != nil {
+		return err
+	}
 
-	if isFirstMaster {
-		klog.V(0).InfoS("Processing first master node",
-			"node", currentNode.Name)
+	// A rollout whose first step succeeded only has the upload and the VKE
+	// update left, rotating again would restart the server for nothing.
+	record, found, err := a.loadRollout()
+	if err != nil {
+		return err
+	}
+	if found && record.ExpireDate == decision.ExpireDate.UTC().Format(time.RFC3339) && record.renewed(currentNode.Name) {
+		return a.finishRollout(currentNode, cluster)
+	}
 
-		if err := restartService("rke2-server"); err != nil {
+	if decision.Tier != constants.RenewalTierForce && config.GlobalConfig.GetApprovalConfig().Enabled {
+		escalated, err := a.checkRenewalApproval(decision, true)
+		if err != nil {
 			return err
 		}
+		if escalated {
+			decision.Tier = constants.RenewalTierForce
+			decision.Reason = fmt.Sprintf("renewal was not approved within %s", config.GlobalConfig.GetApprovalConfig().Timeout)
+		}
+	}
 
-		kubeconfigData, err := os.ReadFile("/etc/rancher/rke2/rke2.yaml")
+	// The window is checked against the whole rollout, so a window closing
+	// between two masters cannot leave the control plane half renewed. The
+	// force tier skips the check.
+	if decision.Tier != constants.RenewalTierForce {
+		renewalDuration := time.Duration(len(masters))*renewalConfig.MasterStagger +
+			config.GlobalConfig.GetLoadbalancerConfig().MemberHealthTimeout
+		emergency, err := a.checkDisruptionAllowed(constants.ActionMasterRenewal, renewalDuration, decision.ExpireDate)
 		if err != nil {
-			return fmt.Errorf("failed to read kubeconfig: %v", err)
+			a.recordStep(currentNode, v1.EventTypeNormal, deferralReason(err),
+				"Certificate renewal deferred: %v", err)
+			return err
 		}
-
-		var kubeconfigModel model.KubeConfig
-		if err = yaml.Unmarshal(kubeconfigData, &kubeconfigModel); err != nil {
-			return fmt.Errorf("failed to unmarshal kubeconfig: %v", err)
+		if emergency {
+			a.recordStep(currentNode, v1.EventTypeWarning, constants.EventReasonChangeFreezeOverridden,
+				"Certificate renewal started during a change freeze, the certificates expire at %s",
+				cluster.Data.ClusterCertificateExpireDate.Format(time.RFC3339))
 		}
+	}
 
-		kubeconfigModel.Clusters[0].Cluster.Server = fmt.Sprintf("https://%s:6443", cluster.Data.ClusterEndpoint)
-		kubeconfigModel.Clusters[0].Name = cluster.Data.ClusterName
-		kubeconfigModel.Contexts[0].Context.Cluster = cluster.Data.ClusterName
-		kubeconfigModel.Contexts[0].Context.User = cluster.Data.ClusterName
-		kubeconfigModel.Contexts[0].Name = cluster.Data.ClusterName
-		kubeconfigModel.CurrentContext = cluster.Data.ClusterName
-		kubeconfigModel.Users[0].Name = cluster.Data.ClusterName
+	// Without a health monitor the renewed master could not be verified
+	// after the restart, so the renewal fails before touching the node.
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseLoadbalancerHealth, func() error {
+		return a.checkLoadbalancerHealthMonitors(cluster)
+	}); err != nil {
+		return err
+	}
 
-		updatedKubeconfigData, err := yaml.Marshal(kubeconfigModel)
-		if err != nil {
-			return fmt.Errorf("failed to marshal kubeconfig: %v", err)
-		}
+	record, err = a.startRollout(decision, masters)
+	if err != nil {
+		return err
+	}
 
-		kubeconfigBase64 := base64.StdEncoding.EncodeToString(updatedKubeconfigData)
-		if err := a.iVKEClusterService.UpdateKubeconfig(
-			clID,
-			a.getLatestToken(),
-			config.GlobalConfig.GetVKEConfig().VKEURL,
-			kubeconfigBase64,
-		); err != nil {
-			return fmt.Errorf("failed to update kubeconfig: %v", err)
-		}
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonRenewalStarted,
+		"Control-plane certificate renewal started, position 1 of %d, tier %s: %s",
+		len(masters), decision.Tier, decision.Reason)
+
+	klog.V(0).InfoS("Processing first master node",
+		"node", currentNode.Name)
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseBackup, func() error {
+		return a.backupBeforeRenewal(currentNode.Name)
+	}); err != nil {
+		return err
+	}
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseRotate, a.distribution.RotateCertificates); err != nil {
+		return err
+	}
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonServiceRestarted,
+		"Restarted %s to rotate the control-plane certificates", a.distribution.ServerUnit())
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseLoadbalancerHealth, func() error {
+		return a.waitForHealthyLoadbalancerMembers(cluster, []v1.Node{*currentNode})
+	}); err != nil {
+		return err
+	}
+
+	if err := a.markRolloutRenewed(currentNode.Name, record.ExpireDate); err != nil {
+		return err
+	}
+
+	return a.finishRollout(currentNode, cluster)
+}
+
+// finishRollout uploads the kubeconfig of the renewed first master and
+// records the new expiry in VKE. The other masters follow the recorded
+// rollout, not VKE, so they still renew after the expiry changed.
+func (a *appService) finishRollout(currentNode *v1.Node, cluster *resource.VKEClusterResponse) error {
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseKubeconfigUpload, func() error {
+		return a.uploadRenewedKubeconfig(cluster)
+	}); err != nil {
+		return err
+	}
 
+	return a.runRenewalPhase(currentNode, constants.RenewalPhaseVKEUpdate, func() error {
+		expireDate := a.clock.Now().Add(config.GlobalConfig.GetRenewalConfig().CertificateLifetime)
 		clReq := request.UpdateClusterRequest{
-			ClusterCertificateExpireDate: getCurrentTime().AddDate(0, 0, 359),
+			ClusterCertificateExpireDate: expireDate,
 			ClusterName:                  cluster.Data.ClusterName,
 			ClusterVersion:               cluster.Data.ClusterVersion,
 			ClusterStatus:                cluster.Data.ClusterStatus,
 			ClusterAPIAccess:             cluster.Data.ClusterAPIAccess,
+
+			ClusterApplicationCredentialExpireDate: cluster.Data.ClusterApplicationCredentialExpireDate,
 		}
 		if err := a.iVKEClusterService.UpdateCluster(
-			clID,
+			config.GlobalConfig.GetVKEConfig().ClusterID,
 			a.getLatestToken(),
 			config.GlobalConfig.GetVKEConfig().VKEURL,
 			clReq); err != nil {
 			return fmt.Errorf("failed to update cluster: %v", err)
 		}
+		a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonVKEClusterUpdated,
+			"Recorded the renewed certificates in VKE, they expire at %s", expireDate.Format(time.RFC3339))
+		return nil
+	})
+}
+
+// uploadRenewedKubeconfig uploads the admin kubeconfig of the renewed first
+// master, or a dedicated admin credential minted through it, to VKE.
+func (a *appService) uploadRenewedKubeconfig(cluster *resource.VKEClusterResponse) error {
+	kubeconfigData, err := os.ReadFile(a.distribution.AdminKubeconfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+
+	kubeconfig, err := rewriteKubeconfig(kubeconfigData, cluster.Data.ClusterName,
+		fmt.Sprintf("https://%s:%d", cluster.Data.ClusterEndpoint, constants.KubeAPIServerPort))
+	if err != nil {
+		return fmt.Errorf("failed to rewrite kubeconfig: %v", err)
+	}
+
+	if config.GlobalConfig.GetKubeconfigConfig().AdminCSREnabled {
+		kubeconfig, err = a.mintAdminKubeconfig(kubeconfig)
+		if err != nil {
+			return fmt.Errorf("failed to mint admin kubeconfig: %v", err)
+		}
+	}
+
+	return a.uploadKubeconfig(kubeconfig, cluster.Data.ClusterEndpoint)
+}
 
+// backupBeforeRenewal archives the node's TLS material and kubeconfig to
+// Swift. Renewal must not continue when an enabled backup fails.
+func (a *appService) backupBeforeRenewal(nodeName string) error {
+	if !config.GlobalConfig.GetBackupConfig().Enabled {
 		return nil
 	}
 
-	if isOtherMaster {
-		klog.V(2).InfoS("Processing other master node, waiting before restart",
-			"node", currentNode.Name)
-		time.Sleep(2 * time.Minute)
-		return restartService("rke2-server")
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return fmt.Errorf("failed to get openstack session for backup: %v", err)
+	}
+
+	name, err := a.iBackupService.CreateBackup(providerClient, nodeName, a.distribution.CertificateDir(), a.distribution.AdminKubeconfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to back up certificates before renewal: %v", err)
 	}
 
+	klog.V(0).InfoS("Certificates backed up before renewal",
+		"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+		"node", nodeName,
+		"object", name,
+		"component", "backup")
+
 	return nil
 }
 
@@ -213,7 +381,17 @@ func isMasterNode(node *v1.Node) bool {
 	return isMaster || isControlPlane
 }
 
-func getFirstMasterNode(client *kubernetes.Clientset) (*v1.Node, error) {
+func getFirstMasterNode(client kubernetes.Interface) (*v1.Node, error) {
+	masters, err := getMasterNodes(client)
+	if err != nil {
+		return nil, err
+	}
+	return &masters[0], nil
+}
+
+// getMasterNodes returns the control-plane nodes ordered from the oldest to
+// the newest, which is also the order in which they are renewed.
+func getMasterNodes(client kubernetes.Interface) ([]v1.Node, error) {
 	nodes, err := client.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{
 		LabelSelector: "node-role.kubernetes.io/control-plane",
 	})
@@ -230,16 +408,32 @@ func getFirstMasterNode(client *kubernetes.Clientset) (*v1.Node, error) {
 		return nil, fmt.Errorf("no master nodes found")
 	}
 
-	firstMaster := nodes.Items[0]
-	for _, node := range nodes.Items {
-		if node.CreationTimestamp.Before(&firstMaster.CreationTimestamp) {
-			firstMaster = node
-		}
+	masters := nodes.Items
+	sort.SliceStable(masters, func(i, j int) bool {
+		return masters[i].CreationTimestamp.Before(&masters[j].CreationTimestamp)
+	})
+	return masters, nil
+}
+
+func (a *appService) isFirstMasterNode() (bool, error) {
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return false, fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	if !a.distribution.IsControlPlane(currentNode) {
+		return false, nil
 	}
-	return &firstMaster, nil
+
+	firstMaster, err := getFirstMasterNode(a.k8sClient)
+	if err != nil {
+		return false, fmt.Errorf("failed to determine first master node: %v", err)
+	}
+
+	return currentNode.Name == firstMaster.Name, nil
 }
 
-func getCurrentNode(client *kubernetes.Clientset) (*v1.Node, error) {
+func getCurrentNode(client kubernetes.Interface) (*v1.Node, error) {
 	nodeName := os.Getenv("NODE_NAME")
 	if nodeName == "" {
 		return nil, fmt.Errorf("NODE_NAME environment variable is not set")
@@ -252,57 +446,72 @@ func restartService(serviceName string) error {
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	metrics.ObserveServiceRestart(serviceName, err)
+	if err != nil {
 		return fmt.Errorf("failed to restart %s: %v, stderr: %s", serviceName, err, stderr.String())
 	}
 	return nil
 }
 
-func (a *appService) RestartWorkerNodes() error {
+// restartWorkerAgent restarts the node agent of a worker so it picks up
+// the certificates renewed by record, once maintenance windows and change
+// freezes allow it, and records that on the node.
+func (a *appService) restartWorkerAgent(currentNode *v1.Node, record rolloutRecord) error {
+	defer setRenewalPhase(constants.RenewalPhaseIdle)
 	clID := config.GlobalConfig.GetVKEConfig().ClusterID
 
-	klog.V(2).InfoS("Starting worker nodes restart process",
-		"cluster_id", clID,
-		"component", "worker_restarter")
-
-	currentNode, err := getCurrentNode(a.k8sClient)
+	expireDate, err := time.Parse(time.RFC3339, record.ExpireDate)
 	if err != nil {
-		return fmt.Errorf("failed to get current node: %v", err)
+		return fmt.Errorf("failed to read rollout expiry %q: %v", record.ExpireDate, err)
 	}
 
-	if isMasterNode(currentNode) {
-		klog.V(2).InfoS("Skipping restart on master node",
-			"cluster_id", clID,
-			"node", currentNode.Name,
-			"component", "worker_restarter")
-		return nil
+	setRenewalPhase(constants.RenewalPhaseWorkerWait)
+	if record.Tier != constants.RenewalTierForce && a.waitForDisruptionAllowed(currentNode, constants.ActionWorkerRestart, 0, expireDate) {
+		a.recordStep(currentNode, v1.EventTypeWarning, constants.EventReasonChangeFreezeOverridden,
+			"Node agent restarted during a change freeze to finish an emergency certificate renewal")
 	}
 
-	klog.V(0).InfoS("Restarting RKE2 agent on worker node",
+	a.waitUntilUnpaused(constants.ActionWorkerRestart, currentNode)
+
+	klog.V(0).InfoS("Restarting node agent on worker node",
 		"cluster_id", clID,
+		"distribution", a.distribution.Name(),
+		"unit", a.distribution.AgentUnit(),
 		"node", currentNode.Name,
 		"node_uid", currentNode.UID,
 		"component", "worker_restarter")
 
-	if err := restartService("rke2-agent"); err != nil {
-		klog.ErrorS(err, "Failed to restart RKE2 agent",
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseWorkerRestart, a.distribution.RestartAgent); err != nil {
+		klog.ErrorS(err, "Failed to restart node agent",
 			"cluster_id", clID,
 			"node", currentNode.Name,
 			"node_uid", currentNode.UID,
 			"component", "worker_restarter")
-		return fmt.Errorf("failed to restart RKE2 agent on node %s: %v", currentNode.Name, err)
+		return fmt.Errorf("failed to restart %s on node %s: %v", a.distribution.AgentUnit(), currentNode.Name, err)
+	}
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonServiceRestarted,
+		"Restarted %s to pick up the renewed cluster certificates", a.distribution.AgentUnit())
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				constants.RenewalRestartedAnnotation: record.ExpireDate,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build restart patch: %v", err)
+	}
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), currentNode.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record node agent restart: %v", err)
 	}
 
 	return nil
 }
 
 func (a *appService) getLatestToken() string {
-	pjID := config.GlobalConfig.GetVKEConfig().ProjectID
-	applicationCredentialID := config.GlobalConfig.GetVKEConfig().ApplicationCredentialID
-	applicationCredentialSecret := config.GlobalConfig.GetVKEConfig().ApplicationCredentialSecret
-	identityURL := config.GlobalConfig.GetVKEConfig().IdentityURL
-
-	providerClient, err := a.GetOpenstackSession(pjID, applicationCredentialID, applicationCredentialSecret, identityURL)
+	providerClient, err := a.getLatestProviderClient()
 	if err != nil {
 		klog.Error(err, "Failed to get openstack session for token refresh")
 		return ""
@@ -310,3 +519,12 @@ func (a *appService) getLatestToken() string {
 
 	return providerClient.Token()
 }
+
+func (a *appService) getLatestProviderClient() (*gophercloud.ProviderClient, error) {
+	pjID := config.GlobalConfig.GetVKEConfig().ProjectID
+	applicationCredentialID := config.GlobalConfig.GetVKEConfig().ApplicationCredentialID
+	applicationCredentialSecret := config.GlobalConfig.GetVKEConfig().ApplicationCredentialSecret
+	identityURL := config.GlobalConfig.GetVKEConfig().IdentityURL
+
+	return a.GetOpenstackSession(pjID, applicationCredentialID, applicationCredentialSecret, identityURL)
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ErrAwaitingApproval is returned when a control-plane renewal is not started
+// because it has not been approved yet.
+var ErrAwaitingApproval = errors.New("awaiting renewal approval")
+
+// Keys of the approval ConfigMap data.
+const (
+	approvalKeyState       = "state"
+	approvalKeyExpireDate  = "expire_date"
+	approvalKeyTier        = "tier"
+	approvalKeyReason      = "reason"
+	approvalKeyRequestedAt = "requested_at"
+	approvalKeyApprovedBy  = "approved_by"
+	approvalKeyDecidedAt   = "decided_at"
+	approvalKeyHistory     = "history"
+)
+
+// approvalRecord is an entry of the approval audit trail.
+type approvalRecord struct {
+	ExpireDate  string `json:"expire_date"`
+	RequestedAt string `json:"requested_at"`
+	State       string `json:"state"`
+	ApprovedBy  string `json:"approved_by,omitempty"`
+	DecidedAt   string `json:"decided_at"`
+}
+
+// checkRenewalApproval returns nil once the renewal for decision has been
+// approved, and reports whether it escalated to the force tier because no
+// approval arrived within the timeout. The first master records the pending
+// renewal on the approval ConfigMap and picks up the approval annotation,
+// the other masters follow what it recorded.
+func (a *appService) checkRenewalApproval(decision model.RenewalDecision, isFirstMaster bool) (escalated bool, err error) {
+	approvalConfig := config.GlobalConfig.GetApprovalConfig()
+	namespace := config.GlobalConfig.GetWebConfig().Namespace
+	configMaps := a.k8sClient.CoreV1().ConfigMaps(namespace)
+	expireDate := decision.ExpireDate.UTC().Format(time.RFC3339)
+
+	configMap, err := configMaps.Get(context.Background(), approvalConfig.ConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) && isFirstMaster {
+		configMap, err = configMaps.Create(context.Background(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: approvalConfig.ConfigMapName, Namespace: namespace},
+		}, metav1.CreateOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("%w: renewal has not been requested yet", ErrAwaitingApproval)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get approval ConfigMap %s/%s: %v", namespace, approvalConfig.ConfigMapName, err)
+	}
+
+	if configMap.Data[approvalKeyExpireDate] != expireDate {
+		if !isFirstMaster {
+			return false, fmt.Errorf("%w: renewal has not been requested yet", ErrAwaitingApproval)
+		}
+		return false, a.requestRenewalApproval(configMap, decision)
+	}
+
+	switch configMap.Data[approvalKeyState] {
+	case constants.RenewalApprovalApproved:
+		return false, nil
+	case constants.RenewalApprovalEscalated:
+		return true, nil
+	}
+
+	// A request time that cannot be read would escalate at once, so the
+	// renewal is requested again instead.
+	requestedAt, err := time.Parse(time.RFC3339, configMap.Data[approvalKeyRequestedAt])
+	if err != nil {
+		if !isFirstMaster {
+			return false, fmt.Errorf("%w: renewal has not been requested yet", ErrAwaitingApproval)
+		}
+		klog.Warningf("Unreadable renewal request time, requesting approval again - configmap: %s/%s, requested_at: %q",
+			namespace, approvalConfig.ConfigMapName, configMap.Data[approvalKeyRequestedAt])
+		return false, a.requestRenewalApproval(configMap, decision)
+	}
+	escalateAt := requestedAt.Add(approvalConfig.Timeout)
+	if !isFirstMaster {
+		return false, fmt.Errorf("%w: renewal requested at %s", ErrAwaitingApproval, requestedAt.Format(time.RFC3339))
+	}
+
+	if approver := configMap.Annotations[constants.RenewalApprovedByAnnotation]; approver != "" {
+		if err := a.decideRenewalApproval(configMap, constants.RenewalApprovalApproved, approver); err != nil {
+			return false, err
+		}
+		a.eventRecorder.Eventf(configMap, v1.EventTypeNormal, constants.EventReasonRenewalApproved,
+			"Renewal of the certificates expiring at %s approved by %s", expireDate, approver)
+		return false, nil
+	}
+
+	if !a.clock.Now().Before(escalateAt) {
+		if err := a.decideRenewalApproval(configMap, constants.RenewalApprovalEscalated, ""); err != nil {
+			return false, err
+		}
+		a.eventRecorder.Eventf(configMap, v1.EventTypeWarning, constants.EventReasonRenewalEscalated,
+			"Renewal of the certificates expiring at %s was not approved within %s, escalating to the %s tier",
+			expireDate, approvalConfig.Timeout, constants.RenewalTierForce)
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: renewal requested at %s, approve it with \"kubectl annotate configmap -n %s %s %s=<name>\", escalates at %s",
+		ErrAwaitingApproval, requestedAt.Format(time.RFC3339), namespace, approvalConfig.ConfigMapName,
+		constants.RenewalApprovedByAnnotation, escalateAt.Format(time.RFC3339))
+}
+
+// requestRenewalApproval records a pending renewal on configMap. An approval
+// annotation left from an earlier renewal is removed so it does not approve
+// this one.
+func (a *appService) requestRenewalApproval(configMap *v1.ConfigMap, decision model.RenewalDecision) error {
+	history := configMap.Data[approvalKeyHistory]
+	configMap.Data = map[string]string{
+		approvalKeyState:       constants.RenewalApprovalPending,
+		approvalKeyExpireDate:  decision.ExpireDate.UTC().Format(time.RFC3339),
+		approvalKeyTier:        decision.Tier,
+		approvalKeyReason:      decision.Reason,
+		approvalKeyRequestedAt: a.clock.Now().UTC().Format(time.RFC3339),
+	}
+	if history != "" {
+		configMap.Data[approvalKeyHistory] = history
+	}
+	delete(configMap.Annotations, constants.RenewalApprovedByAnnotation)
+
+	updated, err := a.k8sClient.CoreV1().ConfigMaps(configMap.Namespace).Update(context.Background(), configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to request renewal approval: %v", err)
+	}
+
+	klog.V(0).InfoS("Requested renewal approval",
+		"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+		"configmap", configMap.Namespace+"/"+configMap.Name,
+		"expire_date", decision.ExpireDate,
+		"tier", decision.Tier,
+		"component", "renewal_approval")
+	a.eventRecorder.Eventf(updated, v1.EventTypeNormal, constants.EventReasonRenewalApprovalNeeded,
+		"Control-plane renewal needs approval: %s. Approve it with \"kubectl annotate configmap -n %s %s %s=<name>\"",
+		decision.Reason, configMap.Namespace, configMap.Name, constants.RenewalApprovedByAnnotation)
+
+	return fmt.Errorf("%w: renewal requested", ErrAwaitingApproval)
+}
+
+// decideRenewalApproval records the outcome of the pending renewal and
+// appends it to the audit trail kept on configMap.
+func (a *appService) decideRenewalApproval(configMap *v1.ConfigMap, state, approver string) error {
+	record := approvalRecord{
+		ExpireDate:  configMap.Data[approvalKeyExpireDate],
+		RequestedAt: configMap.Data[approvalKeyRequestedAt],
+		State:       state,
+		ApprovedBy:  approver,
+		DecidedAt:   a.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	var history []approvalRecord
+	if data := configMap.Data[approvalKeyHistory]; data != "" {
+		if err := json.Unmarshal([]byte(data), &history); err != nil {
+			klog.Warningf("Discarding unreadable renewal approval history: %v", err)
+			history = nil
+		}
+	}
+	history = append(history, record)
+	if len(history) > constants.RenewalApprovalHistoryLimit {
+		history = history[len(history)-constants.RenewalApprovalHistoryLimit:]
+	}
+
+	historyData, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("failed to encode renewal approval history: %v", err)
+	}
+
+	configMap.Data[approvalKeyState] = state
+	configMap.Data[approvalKeyDecidedAt] = record.DecidedAt
+	configMap.Data[approvalKeyHistory] = string(historyData)
+	if approver != "" {
+		configMap.Data[approvalKeyApprovedBy] = approver
+	}
+
+	if _, err := a.k8sClient.CoreV1().ConfigMaps(configMap.Namespace).Update(context.Background(), configMap, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to record renewal approval: %v", err)
+	}
+
+	klog.V(0).InfoS("Renewal approval decided",
+		"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+		"configmap", configMap.Namespace+"/"+configMap.Name,
+		"expire_date", record.ExpireDate,
+		"state", state,
+		"approved_by", approver,
+		"component", "renewal_approval")
+
+	return nil
+}
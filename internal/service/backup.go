@@ -0,0 +1,236 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+const (
+	backupObjectSuffix   = ".tar.gz.enc"
+	backupManifestName   = "manifest.json"
+	backupTLSPrefix      = "tls"
+	backupKubeconfigName = "kubeconfig.yaml"
+)
+
+type IBackupService interface {
+	CreateBackup(providerClient *gophercloud.ProviderClient, nodeName, tlsDir, kubeconfigPath string) (string, error)
+	ListBackups(providerClient *gophercloud.ProviderClient, nodeName string) ([]objects.Object, error)
+	FetchBackup(providerClient *gophercloud.ProviderClient, name string) ([]byte, error)
+}
+
+type backupService struct {
+	iObjectStorageService IObjectStorageService
+}
+
+func NewBackupService(iObjectStorageService IObjectStorageService) IBackupService {
+	return &backupService{
+		iObjectStorageService: iObjectStorageService,
+	}
+}
+
+// CreateBackup archives the TLS directory, the admin kubeconfig and a
+// manifest of certificate fingerprints, encrypts the archive and uploads it
+// to Swift. Backups beyond the configured retention are deleted afterwards.
+func (b *backupService) CreateBackup(providerClient *gophercloud.ProviderClient, nodeName, tlsDir, kubeconfigPath string) (string, error) {
+	backupConfig := config.GlobalConfig.GetBackupConfig()
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	if len(backupConfig.EncryptionKey) == 0 {
+		return "", fmt.Errorf("backup encryption key is not configured")
+	}
+
+	now := time.Now().UTC()
+	archive, err := buildBackupArchive(clID, nodeName, now, tlsDir, kubeconfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to build backup archive: %v", err)
+	}
+
+	encrypted, err := utils.EncryptAESGCM(backupConfig.EncryptionKey, archive)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt backup: %v", err)
+	}
+
+	if err := b.iObjectStorageService.EnsureContainer(providerClient, region, backupConfig.Container); err != nil {
+		return "", fmt.Errorf("failed to ensure backup container: %v", err)
+	}
+
+	name := path.Join(backupPrefix(clID, nodeName), now.Format("20060102T150405Z")+backupObjectSuffix)
+	metadata := map[string]string{
+		"Cluster-Id": clID,
+		"Node-Name":  nodeName,
+		"Created-At": now.Format(time.RFC3339),
+	}
+	if err := b.iObjectStorageService.UploadObject(providerClient, region, backupConfig.Container, name, encrypted, metadata); err != nil {
+		return "", fmt.Errorf("failed to upload backup: %v", err)
+	}
+
+	if err := b.pruneBackups(providerClient, nodeName, backupConfig.Retention); err != nil {
+		klog.ErrorS(err, "Failed to prune old backups",
+			"cluster_id", clID,
+			"node", nodeName,
+			"component", "backup")
+	}
+
+	return name, nil
+}
+
+// ListBackups returns the backups of a node, or of every node when nodeName
+// is empty, oldest first.
+func (b *backupService) ListBackups(providerClient *gophercloud.ProviderClient, nodeName string) ([]objects.Object, error) {
+	backupConfig := config.GlobalConfig.GetBackupConfig()
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+
+	backups, err := b.iObjectStorageService.ListObjects(providerClient, config.GlobalConfig.GetVKEConfig().Region,
+		backupConfig.Container, backupPrefix(clID, nodeName))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name < backups[j].Name })
+	return backups, nil
+}
+
+// FetchBackup downloads a backup and returns the decrypted tar.gz archive.
+func (b *backupService) FetchBackup(providerClient *gophercloud.ProviderClient, name string) ([]byte, error) {
+	backupConfig := config.GlobalConfig.GetBackupConfig()
+	if len(backupConfig.EncryptionKey) == 0 {
+		return nil, fmt.Errorf("backup encryption key is not configured")
+	}
+
+	encrypted, err := b.iObjectStorageService.DownloadObject(providerClient, config.GlobalConfig.GetVKEConfig().Region,
+		backupConfig.Container, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.DecryptAESGCM(backupConfig.EncryptionKey, encrypted)
+}
+
+func (b *backupService) pruneBackups(providerClient *gophercloud.ProviderClient, nodeName string, retention int) error {
+	backups, err := b.ListBackups(providerClient, nodeName)
+	if err != nil {
+		return err
+	}
+
+	region := config.GlobalConfig.GetVKEConfig().Region
+	container := config.GlobalConfig.GetBackupConfig().Container
+	for len(backups) > retention {
+		klog.V(2).InfoS("Deleting expired backup",
+			"node", nodeName,
+			"object", backups[0].Name,
+			"component", "backup")
+		if err := b.iObjectStorageService.DeleteObject(providerClient, region, container, backups[0].Name); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+func backupPrefix(clusterID, nodeName string) string {
+	if nodeName == "" {
+		return clusterID + "/"
+	}
+	return clusterID + "/" + nodeName + "/"
+}
+
+func buildBackupArchive(clusterID, nodeName string, createdAt time.Time, tlsDir, kubeconfigPath string) ([]byte, error) {
+	fingerprints, err := readCertificateFingerprints(tlsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading certificates: %v", err)
+	}
+
+	manifest, err := json.MarshalIndent(model.BackupManifest{
+		ClusterID:    clusterID,
+		NodeName:     nodeName,
+		CreatedAt:    createdAt,
+		Certificates: fingerprints,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding manifest: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(tlsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(tlsDir, p)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		return writeTarFile(tw, path.Join(backupTLSPrefix, filepath.ToSlash(rel)), data, createdAt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error archiving %s: %v", tlsDir, err)
+	}
+
+	kubeconfig, err := os.ReadFile(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kubeconfig: %v", err)
+	}
+	if err := writeTarFile(tw, backupKubeconfigName, kubeconfig, createdAt); err != nil {
+		return nil, err
+	}
+
+	if err := writeTarFile(tw, backupManifestName, manifest, createdAt); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return fmt.Errorf("error writing %s header: %v", name, err)
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+
+	return nil
+}
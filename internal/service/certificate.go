@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
+)
+
+// RecordCertificateExpiry publishes the expiry of the certificates in the
+// distribution's certificate directory, the earliest one per file. Nodes
+// without that directory, such as workers, report nothing.
+func (a *appService) RecordCertificateExpiry() error {
+	dir := a.distribution.CertificateDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	fingerprints, err := readCertificateFingerprints(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read certificates in %s: %v", dir, err)
+	}
+
+	earliest := map[string]time.Time{}
+	for _, fingerprint := range fingerprints {
+		if notAfter, ok := earliest[fingerprint.File]; !ok || fingerprint.NotAfter.Before(notAfter) {
+			earliest[fingerprint.File] = fingerprint.NotAfter
+		}
+	}
+
+	metrics.ResetCertificateExpiry(metrics.SourceLocal)
+	for file, notAfter := range earliest {
+		metrics.SetCertificateExpiry(metrics.SourceLocal, file, notAfter)
+	}
+	return nil
+}
+
+// readCertificateFingerprints walks dir and returns every PEM encoded
+// certificate found in it. Files that are not certificates are skipped.
+func readCertificateFingerprints(dir string) ([]model.CertificateFingerprint, error) {
+	var result []model.CertificateFingerprint
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+
+		for _, cert := range parseCertificates(data) {
+			result = append(result, certificateFingerprint(rel, cert))
+		}
+		return nil
+	})
+	return result, err
+}
+
+// parseCertificates returns the certificates of all CERTIFICATE blocks in a
+// PEM document.
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func certificateFingerprint(file string, cert *x509.Certificate) model.CertificateFingerprint {
+	sum := sha256.Sum256(cert.Raw)
+	return model.CertificateFingerprint{
+		File:      file,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+}
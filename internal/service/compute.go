@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/klog/v2"
+)
+
+type IComputeService interface {
+	GetServer(providerClient *gophercloud.ProviderClient, region, serverID string) (*servers.Server, error)
+	RebootServer(providerClient *gophercloud.ProviderClient, region, serverID string, method servers.RebootMethod) error
+	GetFlavor(providerClient *gophercloud.ProviderClient, region, flavorID string) (*flavors.Flavor, error)
+	GetServerGroup(providerClient *gophercloud.ProviderClient, region, serverGroupID string) (*servergroups.ServerGroup, error)
+}
+
+type computeService struct{}
+
+func NewComputeService() IComputeService {
+	return &computeService{}
+}
+
+func newComputeClient(providerClient *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	client, err := openstack.NewComputeV2(providerClient, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("error creating compute client: %v", err)
+	}
+	return client, nil
+}
+
+func (c *computeService) GetServer(providerClient *gophercloud.ProviderClient, region, serverID string) (*servers.Server, error) {
+	client, err := newComputeClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := servers.Get(client, serverID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get server - server_id: %s, error: %v", serverID, err)
+		return nil, err
+	}
+
+	return server, nil
+}
+
+func (c *computeService) RebootServer(providerClient *gophercloud.ProviderClient, region, serverID string, method servers.RebootMethod) error {
+	client, err := newComputeClient(providerClient, region)
+	if err != nil {
+		return err
+	}
+
+	if err := servers.Reboot(client, serverID, servers.RebootOpts{Type: method}).ExtractErr(); err != nil {
+		klog.Errorf("Failed to reboot server - server_id: %s, method: %s, error: %v", serverID, method, err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *computeService) GetFlavor(providerClient *gophercloud.ProviderClient, region, flavorID string) (*flavors.Flavor, error) {
+	client, err := newComputeClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	flavor, err := flavors.Get(client, flavorID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get flavor - flavor_id: %s, error: %v", flavorID, err)
+		return nil, err
+	}
+
+	return flavor, nil
+}
+
+func (c *computeService) GetServerGroup(providerClient *gophercloud.ProviderClient, region, serverGroupID string) (*servergroups.ServerGroup, error) {
+	client, err := newComputeClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	serverGroup, err := servergroups.Get(client, serverGroupID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get server group - server_group_id: %s, error: %v", serverGroupID, err)
+		return nil, err
+	}
+
+	return serverGroup, nil
+}
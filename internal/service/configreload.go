@@ -0,0 +1,116 @@
+package service
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// WatchConfigMap applies the data of the agent's ConfigMap on top of the
+// startup configuration whenever it changes, until stopCh is closed. Invalid
+// data and changes to settings that need a restart are rejected as a whole.
+// Every node logs the outcome; only the first master reports it as an event
+// on the ConfigMap, which every pod would otherwise repeat.
+func (a *appService) WatchConfigMap(stopCh <-chan struct{}) {
+	webConfig := config.GlobalConfig.GetWebConfig()
+
+	startupVerbosity := ""
+	if verbosityFlag := flag.Lookup("v"); verbosityFlag != nil {
+		startupVerbosity = verbosityFlag.Value.String()
+	}
+	applyLogVerbosity(webConfig.LogVerbosity, startupVerbosity)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(a.k8sClient, 0,
+		informers.WithNamespace(webConfig.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", webConfig.ConfigMapName).String()
+		}))
+
+	apply := func(configMap *v1.ConfigMap, data map[string]string) {
+		changed, err := config.Reload(data)
+		if err != nil {
+			klog.ErrorS(err, "Rejected configuration change",
+				"configmap", webConfig.Namespace+"/"+webConfig.ConfigMapName,
+				"component", "config_reload")
+			if isFirstMaster, _ := a.isFirstMasterNode(); isFirstMaster {
+				a.eventRecorder.Eventf(configMap, v1.EventTypeWarning, constants.EventReasonConfigReloadRejected,
+					"Configuration change rejected, keeping the current configuration: %v", err)
+			}
+			return
+		}
+
+		if len(changed) == 0 {
+			return
+		}
+
+		applyLogVerbosity(config.GlobalConfig.GetWebConfig().LogVerbosity, startupVerbosity)
+		klog.V(0).InfoS("Applied configuration change",
+			"configmap", webConfig.Namespace+"/"+webConfig.ConfigMapName,
+			"changed", changed,
+			"component", "config_reload")
+		if isFirstMaster, _ := a.isFirstMasterNode(); isFirstMaster {
+			a.eventRecorder.Eventf(configMap, v1.EventTypeNormal, constants.EventReasonConfigReloaded,
+				"Applied %s", strings.Join(changed, ", "))
+		}
+	}
+
+	_, err := factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			configMap := obj.(*v1.ConfigMap)
+			apply(configMap, configMap.Data)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			configMap := obj.(*v1.ConfigMap)
+			apply(configMap, configMap.Data)
+		},
+		DeleteFunc: func(obj interface{}) {
+			configMap, ok := obj.(*v1.ConfigMap)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+				if configMap, ok = tombstone.Obj.(*v1.ConfigMap); !ok {
+					return
+				}
+			}
+			apply(configMap, nil)
+		},
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to watch configuration ConfigMap",
+			"component", "config_reload")
+		return
+	}
+
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	<-stopCh
+}
+
+// applyLogVerbosity sets the klog verbosity, or restores the one given on
+// the command line when level is negative.
+func applyLogVerbosity(level int, startupVerbosity string) {
+	value := startupVerbosity
+	if level >= 0 {
+		value = strconv.Itoa(level)
+	}
+	if value == "" {
+		return
+	}
+
+	var verbosity klog.Level
+	if err := verbosity.Set(value); err != nil {
+		klog.ErrorS(err, "Failed to set log verbosity",
+			"component", "config_reload")
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/request"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"k8s.io/klog/v2"
+)
+
+// credentialWarning remembers the last expiry threshold the agent warned
+// about, so every crossing is warned about once rather than on every check.
+type credentialWarning struct {
+	mu        sync.Mutex
+	expiresAt time.Time
+	threshold time.Duration
+}
+
+// shouldWarn reports whether the credential expiring at expiresAt crossed
+// threshold since the last warning. A rotated credential starts over.
+func (w *credentialWarning) shouldWarn(expiresAt time.Time, threshold time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expiresAt.Equal(expiresAt) && w.threshold == threshold {
+		return false
+	}
+	w.expiresAt = expiresAt
+	w.threshold = threshold
+	return true
+}
+
+// checkApplicationCredentialExpiration looks up the application credential the
+// agent authenticates with, warns once its remaining lifetime crosses one of
+// the configured thresholds and reports the expiry date to VKE.
+func (a *appService) checkApplicationCredentialExpiration(providerClient *gophercloud.ProviderClient, cluster *resource.VKEClusterResponse) {
+	vkeConfig := config.GlobalConfig.GetVKEConfig()
+
+	applicationCredential, err := a.iOpenstackService.GetApplicationCredential(providerClient, vkeConfig.ApplicationCredentialID)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get application credential",
+			"cluster_id", vkeConfig.ClusterID,
+			"application_credential_id", vkeConfig.ApplicationCredentialID,
+			"component", "credential_checker")
+		return
+	}
+
+	if applicationCredential.ExpiresAt.IsZero() {
+		klog.V(2).InfoS("Application credential has no expiration date",
+			"cluster_id", vkeConfig.ClusterID,
+			"application_credential_id", vkeConfig.ApplicationCredentialID,
+			"component", "credential_checker")
+		return
+	}
+
+	expiresAt := applicationCredential.ExpiresAt
+	remaining := expiresAt.Sub(a.clock.DecisionTime())
+	if threshold, crossed := crossedThreshold(remaining, vkeConfig.ApplicationCredentialExpiryThresholds); crossed && a.credentialWarning.shouldWarn(expiresAt, threshold) {
+		klog.Warningf("Application credential expires soon - cluster_id: %s, application_credential_id: %s, expires_at: %s, remaining: %s, threshold: %s",
+			vkeConfig.ClusterID, vkeConfig.ApplicationCredentialID, expiresAt.Format(time.RFC3339), remaining.Round(time.Minute), threshold)
+	}
+
+	reported := cluster.Data.ClusterApplicationCredentialExpireDate
+	if reported != nil && reported.Equal(expiresAt) {
+		return
+	}
+
+	isFirstMaster, err := a.isFirstMasterNode()
+	if err != nil {
+		klog.ErrorS(err, "Failed to determine reporting node",
+			"cluster_id", vkeConfig.ClusterID,
+			"component", "credential_checker")
+		return
+	}
+
+	if !isFirstMaster {
+		return
+	}
+
+	clReq := request.UpdateClusterRequest{
+		ClusterCertificateExpireDate: cluster.Data.ClusterCertificateExpireDate,
+		ClusterName:                  cluster.Data.ClusterName,
+		ClusterVersion:               cluster.Data.ClusterVersion,
+		ClusterStatus:                cluster.Data.ClusterStatus,
+		ClusterAPIAccess:             cluster.Data.ClusterAPIAccess,
+
+		ClusterApplicationCredentialExpireDate: &expiresAt,
+	}
+	if err := a.iVKEClusterService.UpdateCluster(vkeConfig.ClusterID, providerClient.Token(), vkeConfig.VKEURL, clReq); err != nil {
+		klog.ErrorS(err, "Failed to report application credential expiration",
+			"cluster_id", vkeConfig.ClusterID,
+			"component", "credential_checker")
+		return
+	}
+
+	klog.V(0).InfoS("Reported application credential expiration to VKE",
+		"cluster_id", vkeConfig.ClusterID,
+		"expires_at", expiresAt,
+		"component", "credential_checker")
+}
+
+// crossedThreshold returns the smallest threshold that the remaining lifetime
+// has already fallen below. Thresholds are expected longest first.
+func crossedThreshold(remaining time.Duration, thresholds []time.Duration) (time.Duration, bool) {
+	var crossed time.Duration
+	found := false
+	for _, threshold := range thresholds {
+		if remaining <= threshold {
+			crossed = threshold
+			found = true
+		}
+	}
+	return crossed, found
+}
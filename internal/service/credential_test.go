@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCredentialWarningOncePerCrossing(t *testing.T) {
+	var w credentialWarning
+	expiresAt := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	if !w.shouldWarn(expiresAt, 30*24*time.Hour) {
+		t.Error("first crossing of the 30d threshold is not warned about")
+	}
+	if w.shouldWarn(expiresAt, 30*24*time.Hour) {
+		t.Error("30d threshold is warned about again on the next check")
+	}
+	if !w.shouldWarn(expiresAt, 7*24*time.Hour) {
+		t.Error("crossing of the 7d threshold is not warned about")
+	}
+	if !w.shouldWarn(expiresAt.AddDate(1, 0, 0), 7*24*time.Hour) {
+		t.Error("rotated credential crossing a threshold is not warned about")
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+const (
+	adminCSRNamePrefix   = "vke-cluster-agent-admin-"
+	adminCSRPollInterval = 2 * time.Second
+	adminCSRTimeout      = 2 * time.Minute
+)
+
+// mintAdminKubeconfig issues a new client certificate for the configured admin
+// user and groups through the certificates.k8s.io/v1 API and returns a copy of
+// base that authenticates with it. The credential's lifetime is independent
+// of the node certificates.
+func (a *appService) mintAdminKubeconfig(base *clientcmdapi.Config) (*clientcmdapi.Config, error) {
+	kubeconfigConfig := config.GlobalConfig.GetKubeconfigConfig()
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   kubeconfigConfig.AdminUser,
+			Organization: kubeconfigConfig.AdminGroups,
+		},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %v", err)
+	}
+
+	expirationSeconds := int32(kubeconfigConfig.AdminCertificateLifetime.Seconds())
+	csr, err := a.k8sClient.CertificatesV1().CertificateSigningRequests().Create(ctx, &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: adminCSRNamePrefix,
+		},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:           pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}),
+			SignerName:        certificatesv1.KubeAPIServerClientSignerName,
+			ExpirationSeconds: &expirationSeconds,
+			Usages: []certificatesv1.KeyUsage{
+				certificatesv1.UsageDigitalSignature,
+				certificatesv1.UsageClientAuth,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate signing request: %v", err)
+	}
+
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+		Type:           certificatesv1.CertificateApproved,
+		Status:         v1.ConditionTrue,
+		Reason:         "VKEClusterAgentApproved",
+		Message:        "Admin kubeconfig for VKE requested by vke-cluster-agent",
+		LastUpdateTime: metav1.Now(),
+	})
+	if _, err := a.k8sClient.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to approve certificate signing request %s: %v", csr.Name, err)
+	}
+
+	var certPEM []byte
+	err = wait.PollUntilContextTimeout(ctx, adminCSRPollInterval, adminCSRTimeout, true, func(ctx context.Context) (bool, error) {
+		current, err := a.k8sClient.CertificatesV1().CertificateSigningRequests().Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+
+		for _, condition := range current.Status.Conditions {
+			if condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed {
+				return false, fmt.Errorf("certificate signing request %s %s: %s", csr.Name, condition.Type, condition.Message)
+			}
+		}
+
+		certPEM = current.Status.Certificate
+		return len(certPEM) > 0, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("certificate signing request %s was not issued: %v", csr.Name, err)
+	}
+
+	certs := parseCertificates(certPEM)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("certificate signing request %s returned no certificate", csr.Name)
+	}
+
+	kubeconfig := base.DeepCopy()
+	kubeContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.ClientCertificateData = certPEM
+	authInfo.ClientKeyData = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	kubeconfig.AuthInfos[kubeContext.AuthInfo] = authInfo
+
+	klog.V(0).InfoS("Issued dedicated admin certificate",
+		"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+		"csr", csr.Name,
+		"user", kubeconfigConfig.AdminUser,
+		"groups", kubeconfigConfig.AdminGroups,
+		"expires_at", certs[0].NotAfter,
+		"component", "kubeconfig")
+	if currentNode, err := getCurrentNode(a.k8sClient); err == nil {
+		a.eventRecorder.Eventf(currentNode, v1.EventTypeNormal, constants.EventReasonAdminCertificateIssued,
+			"Issued admin certificate for %s through %s, expires at %s", kubeconfigConfig.AdminUser, csr.Name, certs[0].NotAfter.Format(time.RFC3339))
+	}
+
+	return kubeconfig, nil
+}
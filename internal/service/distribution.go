@@ -0,0 +1,252 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const kubeadmStaticPodRestartWait = 30 * time.Second
+
+// kubeadmStaticPods are the control-plane static pods restarted after
+// kubeadm renewed their certificates.
+var kubeadmStaticPods = []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler", "etcd"}
+
+// IDistribution hides what differs between the Kubernetes distributions the
+// agent manages: where the admin kubeconfig and certificates live, which
+// services run the node and how control-plane certificates are rotated.
+type IDistribution interface {
+	Name() string
+	ServerUnit() string
+	AgentUnit() string
+	AdminKubeconfigPath() string
+	CertificateDir() string
+	// ControlPlanePorts are the ports the API load balancer forwards to every
+	// control-plane node.
+	ControlPlanePorts() []int
+	IsControlPlane(node *v1.Node) bool
+	// RotateCertificates renews the certificates of a control-plane node and
+	// restarts whatever serves them.
+	RotateCertificates() error
+	// RestartAgent restarts the node agent of a worker so it picks up the
+	// renewed cluster certificates.
+	RestartAgent() error
+}
+
+// NewDistribution returns the distribution called name. For auto, or an
+// empty name, it is detected from the kubelet version of the current node.
+func NewDistribution(name string, k8sClient *kubernetes.Clientset) (IDistribution, error) {
+	if name == "" || name == constants.DistributionAuto {
+		detected, err := detectDistribution(k8sClient)
+		if err != nil {
+			return nil, err
+		}
+		name = detected
+	}
+
+	switch name {
+	case constants.DistributionRKE2:
+		return &rke2Distribution{}, nil
+	case constants.DistributionK3s:
+		return &k3sDistribution{}, nil
+	case constants.DistributionKubeadm:
+		return &kubeadmDistribution{}, nil
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", name)
+	}
+}
+
+// detectDistribution derives the distribution from the kubelet version of the
+// current node, e.g. v1.29.4+rke2r1 or v1.29.4+k3s1. Kubelets without a
+// distribution suffix are assumed to be kubeadm clusters.
+func detectDistribution(k8sClient *kubernetes.Clientset) (string, error) {
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		return "", fmt.Errorf("NODE_NAME environment variable is not set")
+	}
+
+	node, err := k8sClient.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	kubeletVersion := node.Status.NodeInfo.KubeletVersion
+	switch {
+	case strings.Contains(kubeletVersion, "+rke2"):
+		return constants.DistributionRKE2, nil
+	case strings.Contains(kubeletVersion, "+k3s"):
+		return constants.DistributionK3s, nil
+	default:
+		return constants.DistributionKubeadm, nil
+	}
+}
+
+type rke2Distribution struct{}
+
+func (d *rke2Distribution) Name() string {
+	return constants.DistributionRKE2
+}
+
+func (d *rke2Distribution) ServerUnit() string {
+	return "rke2-server"
+}
+
+func (d *rke2Distribution) AgentUnit() string {
+	return "rke2-agent"
+}
+
+func (d *rke2Distribution) AdminKubeconfigPath() string {
+	return constants.RKE2KubeconfigPath
+}
+
+func (d *rke2Distribution) CertificateDir() string {
+	return constants.RKE2ServerTLSDir
+}
+
+func (d *rke2Distribution) ControlPlanePorts() []int {
+	return []int{constants.KubeAPIServerPort, constants.RKE2SupervisorPort}
+}
+
+func (d *rke2Distribution) IsControlPlane(node *v1.Node) bool {
+	return isMasterNode(node)
+}
+
+// RotateCertificates restarts rke2-server, which renews certificates that are
+// close to expiry on start.
+func (d *rke2Distribution) RotateCertificates() error {
+	return restartService(d.ServerUnit())
+}
+
+func (d *rke2Distribution) RestartAgent() error {
+	return restartService(d.AgentUnit())
+}
+
+type k3sDistribution struct{}
+
+func (d *k3sDistribution) Name() string {
+	return constants.DistributionK3s
+}
+
+func (d *k3sDistribution) ServerUnit() string {
+	return "k3s"
+}
+
+func (d *k3sDistribution) AgentUnit() string {
+	return "k3s-agent"
+}
+
+func (d *k3sDistribution) AdminKubeconfigPath() string {
+	return constants.K3sKubeconfigPath
+}
+
+func (d *k3sDistribution) CertificateDir() string {
+	return constants.K3sServerTLSDir
+}
+
+// ControlPlanePorts only has the API server port, K3s serves its supervisor
+// API on the same port.
+func (d *k3sDistribution) ControlPlanePorts() []int {
+	return []int{constants.KubeAPIServerPort}
+}
+
+func (d *k3sDistribution) IsControlPlane(node *v1.Node) bool {
+	return isMasterNode(node)
+}
+
+// RotateCertificates restarts k3s, which renews certificates that are close
+// to expiry on start.
+func (d *k3sDistribution) RotateCertificates() error {
+	return restartService(d.ServerUnit())
+}
+
+func (d *k3sDistribution) RestartAgent() error {
+	return restartService(d.AgentUnit())
+}
+
+type kubeadmDistribution struct{}
+
+func (d *kubeadmDistribution) Name() string {
+	return constants.DistributionKubeadm
+}
+
+func (d *kubeadmDistribution) ServerUnit() string {
+	return "kubelet"
+}
+
+func (d *kubeadmDistribution) AgentUnit() string {
+	return "kubelet"
+}
+
+func (d *kubeadmDistribution) AdminKubeconfigPath() string {
+	return constants.KubeadmKubeconfigPath
+}
+
+func (d *kubeadmDistribution) CertificateDir() string {
+	return constants.KubeadmPKIDir
+}
+
+func (d *kubeadmDistribution) ControlPlanePorts() []int {
+	return []int{constants.KubeAPIServerPort}
+}
+
+func (d *kubeadmDistribution) IsControlPlane(node *v1.Node) bool {
+	_, isControlPlane := node.Labels["node-role.kubernetes.io/control-plane"]
+	return isControlPlane
+}
+
+// RotateCertificates runs kubeadm certs renew all on the host, then stops the
+// control-plane static pod containers so the kubelet recreates them with the
+// renewed certificates.
+func (d *kubeadmDistribution) RotateCertificates() error {
+	if _, err := runOnHost("kubeadm", "certs", "renew", "all"); err != nil {
+		return err
+	}
+
+	for _, pod := range kubeadmStaticPods {
+		output, err := runOnHost("crictl", "ps", "--quiet", "--state", "running", "--name", "^"+pod+"$")
+		if err != nil {
+			return err
+		}
+
+		for _, containerID := range strings.Fields(output) {
+			klog.V(2).Infof("Restarting static pod container - pod: %s, container: %s", pod, containerID)
+			if _, err := runOnHost("crictl", "stop", containerID); err != nil {
+				return err
+			}
+		}
+
+		// Give the kubelet time to bring the component back before the
+		// next one goes down, etcd and the API server depend on each other.
+		time.Sleep(kubeadmStaticPodRestartWait)
+	}
+
+	return restartService(d.ServerUnit())
+}
+
+func (d *kubeadmDistribution) RestartAgent() error {
+	return restartService(d.AgentUnit())
+}
+
+// runOnHost runs a command in the host's namespaces. The agent runs with
+// hostPID, so PID 1 is the host's init process.
+func runOnHost(name string, args ...string) (string, error) {
+	cmd := exec.Command("nsenter", append([]string{"--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--", name}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to run %s %s: %v, stderr: %s", name, strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// statusKeyClusterID is the status ConfigMap data key naming the cluster.
+const statusKeyClusterID = "cluster_id"
+
+// stepStatus caches the status ConfigMap step events are recorded on.
+//
+// Events are expected on a cluster-scoped object, but the agent owns none
+// without a CRD, and events about cluster-scoped objects land in the default
+// namespace. The ConfigMap lives in the agent's namespace, next to the
+// approval and configuration ConfigMaps, and needs no RBAC beyond theirs.
+type stepStatus struct {
+	mu        sync.Mutex
+	configMap *v1.ConfigMap
+}
+
+// statusConfigMap returns the ConfigMap collecting the step events of every
+// node, creating it when it does not exist yet.
+func (a *appService) statusConfigMap() (*v1.ConfigMap, error) {
+	a.status.mu.Lock()
+	cached := a.status.configMap
+	a.status.mu.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+	return a.fetchStatusConfigMap()
+}
+
+// fetchStatusConfigMap reads the status ConfigMap, or creates it, and
+// caches the result.
+func (a *appService) fetchStatusConfigMap() (*v1.ConfigMap, error) {
+	namespace := config.GlobalConfig.GetWebConfig().Namespace
+	name := config.GlobalConfig.GetEventsConfig().StatusConfigMapName
+	configMaps := a.k8sClient.CoreV1().ConfigMaps(namespace)
+
+	configMap, err := configMaps.Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Events must not go on to a ConfigMap that was deleted.
+		a.forgetStatusConfigMap()
+		configMap, err = configMaps.Create(context.Background(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data: map[string]string{
+				statusKeyClusterID: config.GlobalConfig.GetVKEConfig().ClusterID,
+			},
+		}, metav1.CreateOptions{})
+		// Every node creates it on its first step, only one wins.
+		if apierrors.IsAlreadyExists(err) {
+			configMap, err = configMaps.Get(context.Background(), name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status ConfigMap %s/%s: %v", namespace, name, err)
+	}
+
+	a.status.mu.Lock()
+	a.status.configMap = configMap
+	a.status.mu.Unlock()
+	return configMap, nil
+}
+
+// forgetStatusConfigMap drops the cached status ConfigMap, so the next step
+// reads or recreates it.
+func (a *appService) forgetStatusConfigMap() {
+	a.status.mu.Lock()
+	defer a.status.mu.Unlock()
+	a.status.configMap = nil
+}
+
+// recordStep records a renewal or restart step as an event on node and on
+// the status ConfigMap, where the message names the node.
+func (a *appService) recordStep(node *v1.Node, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	a.eventRecorder.Event(node, eventtype, reason, message)
+
+	status, err := a.statusConfigMap()
+	if err != nil {
+		klog.ErrorS(err, "Failed to record step on status ConfigMap",
+			"node", node.Name,
+			"reason", reason,
+			"component", "events")
+		return
+	}
+	a.eventRecorder.Eventf(status, eventtype, reason, "%s: %s", node.Name, message)
+}
+
+// phaseFailureReason returns the event reason for a failed renewal phase.
+// The load balancer health phases verify that the masters serve again.
+func phaseFailureReason(phase string) string {
+	switch phase {
+	case constants.RenewalPhaseLoadbalancerHealth:
+		return constants.EventReasonRenewalVerifyFailed
+	case constants.RenewalPhaseRotate, constants.RenewalPhaseWorkerRestart:
+		return constants.EventReasonServiceRestartFailed
+	default:
+		return constants.EventReasonRenewalPhaseFailed
+	}
+}
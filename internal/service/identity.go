@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// SyncNodeIdentity resolves the Nova instance, flavor and availability zone
+// of the node the agent runs on and keeps the matching labels on the Node
+// object up to date. The flavor is cross-checked against the node group VKE
+// has on record.
+func (a *appService) SyncNodeIdentity() error {
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	region := config.GlobalConfig.GetVKEConfig().Region
+
+	metadata, err := a.iMetadataService.GetInstanceMetadata(config.GlobalConfig.GetNodeIdentityConfig().ConfigDrivePath)
+	if err != nil {
+		return fmt.Errorf("failed to get instance metadata: %v", err)
+	}
+
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	if serverID, err := serverIDFromProviderID(currentNode.Spec.ProviderID); err == nil && serverID != metadata.UUID {
+		klog.Warningf("Node provider id does not match instance metadata - node: %s, provider_id: %s, instance_uuid: %s",
+			currentNode.Name, currentNode.Spec.ProviderID, metadata.UUID)
+	}
+
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return fmt.Errorf("failed to get openstack session: %v", err)
+	}
+
+	server, err := a.iComputeService.GetServer(providerClient, region, metadata.UUID)
+	if err != nil {
+		return fmt.Errorf("failed to get server %s: %v", metadata.UUID, err)
+	}
+
+	flavorID, _ := server.Flavor["id"].(string)
+	flavorName, _ := server.Flavor["original_name"].(string)
+	if flavorID != "" {
+		flavor, err := a.iComputeService.GetFlavor(providerClient, region, flavorID)
+		if err != nil {
+			return fmt.Errorf("failed to get flavor %s: %v", flavorID, err)
+		}
+		flavorName = flavor.Name
+	}
+
+	cluster, err := a.iVKEClusterService.GetCluster(clID, providerClient.Token(), config.GlobalConfig.GetVKEConfig().VKEURL)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster: %v", err)
+	}
+
+	desired := map[string]string{
+		constants.TopologyZoneLabel: metadata.AvailabilityZone,
+		constants.InstanceTypeLabel: flavorName,
+	}
+
+	nodeGroup, err := a.findNodeGroup(providerClient, region, cluster, currentNode, metadata.UUID)
+	if err != nil {
+		klog.Warningf("Could not determine VKE node group - cluster_id: %s, node: %s, instance: %s, error: %v",
+			clID, currentNode.Name, metadata.UUID, err)
+	} else if nodeGroup == nil {
+		klog.Warningf("Could not determine VKE node group - cluster_id: %s, node: %s, instance: %s is in none of its server groups",
+			clID, currentNode.Name, metadata.UUID)
+	} else {
+		desired[constants.VKENodeGroupLabel] = nodeGroup.NodeGroupName
+
+		if flavorID != "" && nodeGroup.NodeFlavorUUID != "" && flavorID != nodeGroup.NodeFlavorUUID {
+			klog.Warningf("Node flavor does not match VKE node group - cluster_id: %s, node: %s, node_group: %s, flavor_id: %s, expected_flavor_id: %s",
+				clID, currentNode.Name, nodeGroup.NodeGroupName, flavorID, nodeGroup.NodeFlavorUUID)
+			a.eventRecorder.Eventf(currentNode, v1.EventTypeWarning, constants.EventReasonNodeFlavorMismatch,
+				"Instance flavor %s does not match flavor %s of node group %s", flavorID, nodeGroup.NodeFlavorUUID, nodeGroup.NodeGroupName)
+		}
+	}
+
+	changed := make(map[string]string)
+	for key, value := range desired {
+		if value == "" {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			klog.Warningf("Skipping invalid label value - node: %s, label: %s, value: %s, error: %s",
+				currentNode.Name, key, value, strings.Join(errs, "; "))
+			continue
+		}
+		if currentNode.Labels[key] != value {
+			changed[key] = value
+		}
+	}
+
+	if len(changed) == 0 {
+		klog.V(4).InfoS("Node identity labels are in sync",
+			"cluster_id", clID,
+			"node", currentNode.Name,
+			"component", "node_identity")
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": changed,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build label patch: %v", err)
+	}
+
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), currentNode.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to update node labels: %v", err)
+	}
+
+	klog.V(0).InfoS("Node identity labels updated",
+		"cluster_id", clID,
+		"node", currentNode.Name,
+		"instance_uuid", metadata.UUID,
+		"labels", changed,
+		"component", "node_identity")
+	a.eventRecorder.Eventf(currentNode, v1.EventTypeNormal, constants.EventReasonNodeIdentityUpdated,
+		"Updated labels %s from instance %s", formatLabels(changed), metadata.UUID)
+
+	return nil
+}
+
+// findNodeGroup returns the VKE node group whose Nova server group VKE
+// placed the instance serverID in. Masters are looked up in the master
+// server group, workers in the worker ones. It returns nil when the
+// instance is in none of them; names are not guessed from.
+func (a *appService) findNodeGroup(providerClient *gophercloud.ProviderClient, region string, cluster *resource.VKEClusterResponse, node *v1.Node, serverID string) (*resource.NodeGroup, error) {
+	candidates := cluster.Data.ClusterWorkerServerGroups
+	if a.distribution.IsControlPlane(node) {
+		candidates = []resource.NodeGroup{cluster.Data.ClusterMasterServerGroup}
+	}
+
+	for i := range candidates {
+		nodeGroup := &candidates[i]
+		if nodeGroup.NodeGroupUUID == "" || nodeGroup.NodeGroupName == "" {
+			continue
+		}
+
+		serverGroup, err := a.iComputeService.GetServerGroup(providerClient, region, nodeGroup.NodeGroupUUID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get server group %s of node group %s: %v",
+				nodeGroup.NodeGroupUUID, nodeGroup.NodeGroupName, err)
+		}
+		if slices.Contains(serverGroup.Members, serverID) {
+			return nodeGroup, nil
+		}
+	}
+	return nil, nil
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
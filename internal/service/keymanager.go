@@ -0,0 +1,60 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/keymanager/v1/secrets"
+	"k8s.io/klog/v2"
+)
+
+type IKeyManagerService interface {
+	CreateSecret(providerClient *gophercloud.ProviderClient, region, name string, payload []byte, metadata map[string]string) (string, error)
+}
+
+type keyManagerService struct{}
+
+func NewKeyManagerService() IKeyManagerService {
+	return &keyManagerService{}
+}
+
+func newKeyManagerClient(providerClient *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	client, err := openstack.NewKeyManagerV1(providerClient, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("error creating key manager client: %v", err)
+	}
+	return client, nil
+}
+
+// CreateSecret stores payload as an opaque secret, attaches the metadata and
+// returns the secret reference.
+func (k *keyManagerService) CreateSecret(providerClient *gophercloud.ProviderClient, region, name string, payload []byte, metadata map[string]string) (string, error) {
+	client, err := newKeyManagerClient(providerClient, region)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := secrets.Create(client, secrets.CreateOpts{
+		Name:                   name,
+		Payload:                base64.StdEncoding.EncodeToString(payload),
+		PayloadContentType:     "application/octet-stream",
+		PayloadContentEncoding: "base64",
+		SecretType:             secrets.OpaqueSecret,
+	}).Extract()
+	if err != nil {
+		klog.Errorf("Failed to create secret - name: %s, error: %v", name, err)
+		return "", err
+	}
+
+	if len(metadata) > 0 {
+		if _, err := secrets.CreateMetadata(client, path.Base(secret.SecretRef), secrets.MetadataOpts(metadata)).Extract(); err != nil {
+			klog.Errorf("Failed to set secret metadata - secret_ref: %s, error: %v", secret.SecretRef, err)
+			return "", err
+		}
+	}
+
+	return secret.SecretRef, nil
+}
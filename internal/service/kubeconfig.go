@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/request"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/utils"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+const (
+	kubeconfigVerifyInterval = 10 * time.Second
+	kubeconfigVerifyTimeout  = 2 * time.Minute
+)
+
+// rewriteKubeconfig points the current context of the kubeconfig at server
+// and renames its context, cluster and user after the VKE cluster. Entries
+// are looked up by name and every other field of the file is preserved.
+func rewriteKubeconfig(data []byte, clusterName, server string) (*clientcmdapi.Config, error) {
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %v", err)
+	}
+
+	contextName := kubeconfig.CurrentContext
+	if contextName == "" && len(kubeconfig.Contexts) == 1 {
+		for name := range kubeconfig.Contexts {
+			contextName = name
+		}
+	}
+
+	kubeContext, ok := kubeconfig.Contexts[contextName]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig has no context %q", contextName)
+	}
+
+	kubeCluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("kubeconfig context %q references unknown cluster %q", contextName, kubeContext.Cluster)
+	}
+
+	if _, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]; !ok {
+		return nil, fmt.Errorf("kubeconfig context %q references unknown user %q", contextName, kubeContext.AuthInfo)
+	}
+
+	kubeCluster.Server = server
+
+	renameKubeconfigCluster(kubeconfig, kubeContext.Cluster, clusterName)
+	renameKubeconfigAuthInfo(kubeconfig, kubeContext.AuthInfo, clusterName)
+	if contextName != clusterName {
+		kubeconfig.Contexts[clusterName] = kubeContext
+		delete(kubeconfig.Contexts, contextName)
+	}
+	kubeconfig.CurrentContext = clusterName
+
+	if err := validateKubeconfig(kubeconfig); err != nil {
+		return nil, err
+	}
+
+	return kubeconfig, nil
+}
+
+// validateKubeconfig checks the kubeconfig schema and that its current
+// context is usable.
+func validateKubeconfig(kubeconfig *clientcmdapi.Config) error {
+	if err := clientcmd.Validate(*kubeconfig); err != nil {
+		return fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+
+	if err := clientcmd.ConfirmUsable(*kubeconfig, kubeconfig.CurrentContext); err != nil {
+		return fmt.Errorf("kubeconfig current context is not usable: %v", err)
+	}
+
+	return nil
+}
+
+func renameKubeconfigCluster(kubeconfig *clientcmdapi.Config, oldName, newName string) {
+	if oldName == newName {
+		return
+	}
+
+	kubeconfig.Clusters[newName] = kubeconfig.Clusters[oldName]
+	delete(kubeconfig.Clusters, oldName)
+	for _, kubeContext := range kubeconfig.Contexts {
+		if kubeContext.Cluster == oldName {
+			kubeContext.Cluster = newName
+		}
+	}
+}
+
+func renameKubeconfigAuthInfo(kubeconfig *clientcmdapi.Config, oldName, newName string) {
+	if oldName == newName {
+		return
+	}
+
+	kubeconfig.AuthInfos[newName] = kubeconfig.AuthInfos[oldName]
+	delete(kubeconfig.AuthInfos, oldName)
+	for _, kubeContext := range kubeconfig.Contexts {
+		if kubeContext.AuthInfo == oldName {
+			kubeContext.AuthInfo = newName
+		}
+	}
+}
+
+// currentKubeconfigEntries returns the cluster and user the current context
+// of the kubeconfig refers to.
+func currentKubeconfigEntries(kubeconfig *clientcmdapi.Config) (*clientcmdapi.Cluster, *clientcmdapi.AuthInfo, error) {
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return nil, nil, fmt.Errorf("kubeconfig has no context %q", kubeconfig.CurrentContext)
+	}
+
+	kubeCluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok {
+		return nil, nil, fmt.Errorf("kubeconfig has no cluster %q", kubeContext.Cluster)
+	}
+
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return nil, nil, fmt.Errorf("kubeconfig has no user %q", kubeContext.AuthInfo)
+	}
+
+	return kubeCluster, authInfo, nil
+}
+
+// uploadKubeconfig sends the kubeconfig to VKE. It is validated and used
+// against the cluster endpoint first, so a broken kubeconfig never replaces
+// the one VKE already has. When the Barbican sink is enabled the kubeconfig is
+// stored there too and the secret reference is reported to VKE along with it.
+func (a *appService) uploadKubeconfig(kubeconfig *clientcmdapi.Config, clusterEndpoint string) error {
+	vkeConfig := config.GlobalConfig.GetVKEConfig()
+
+	if err := validateKubeconfig(kubeconfig); err != nil {
+		return err
+	}
+
+	var verifyErr error
+	err := wait.PollUntilContextTimeout(context.Background(), kubeconfigVerifyInterval, kubeconfigVerifyTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			verifyErr = verifyKubeconfig(ctx, kubeconfig, clusterEndpoint)
+			if verifyErr != nil {
+				klog.V(2).InfoS("Kubeconfig verification failed, retrying",
+					"cluster_id", vkeConfig.ClusterID,
+					"endpoint", clusterEndpoint,
+					"error", verifyErr.Error(),
+					"component", "kubeconfig")
+				return false, nil
+			}
+			return true, nil
+		})
+	if err != nil {
+		if verifyErr == nil {
+			verifyErr = err
+		}
+		return fmt.Errorf("kubeconfig verification against %s failed, not uploading: %v", clusterEndpoint, verifyErr)
+	}
+
+	kubeconfigData, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to serialize kubeconfig: %v", err)
+	}
+
+	kubeconfigReq := request.UpdateKubeconfigRequest{
+		Kubeconfig: base64.StdEncoding.EncodeToString(kubeconfigData),
+	}
+
+	if config.GlobalConfig.GetKubeconfigConfig().BarbicanEnabled {
+		secretRef, err := a.storeKubeconfigInBarbican(kubeconfig, kubeconfigData)
+		if err != nil {
+			klog.ErrorS(err, "Failed to store kubeconfig in Barbican",
+				"cluster_id", vkeConfig.ClusterID,
+				"component", "kubeconfig")
+		} else {
+			kubeconfigReq.BarbicanSecretRef = secretRef
+		}
+	}
+
+	if config.GlobalConfig.GetKubeconfigConfig().EncryptionEnabled {
+		if err := encryptKubeconfigRequest(&kubeconfigReq, kubeconfig, kubeconfigData); err != nil {
+			return fmt.Errorf("failed to encrypt kubeconfig, not uploading: %v", err)
+		}
+	}
+
+	if err := a.iVKEClusterService.UpdateKubeconfig(
+		vkeConfig.ClusterID,
+		a.getLatestToken(),
+		vkeConfig.VKEURL,
+		kubeconfigReq,
+	); err != nil {
+		return fmt.Errorf("failed to update kubeconfig: %v", err)
+	}
+
+	if err := a.recordKubeconfigUpload(kubeconfig); err != nil {
+		klog.ErrorS(err, "Failed to record kubeconfig upload",
+			"cluster_id", vkeConfig.ClusterID,
+			"component", "kubeconfig")
+	}
+
+	return nil
+}
+
+// encryptKubeconfigRequest replaces the kubeconfig in req with its envelope
+// encryption for the configured public key. The wrapped data key and the
+// certificate fingerprints travel with it so VKE can decrypt it and drift
+// can still be detected without the private key.
+func encryptKubeconfigRequest(req *request.UpdateKubeconfigRequest, kubeconfig *clientcmdapi.Config, kubeconfigData []byte) error {
+	publicKey := config.GlobalConfig.GetKubeconfigConfig().EncryptionPublicKey
+	if publicKey == nil {
+		return fmt.Errorf("no valid encryption public key configured")
+	}
+
+	fingerprint, err := kubeconfigFingerprints(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	keyID, err := utils.PublicKeyID(publicKey)
+	if err != nil {
+		return err
+	}
+
+	wrappedKey, ciphertext, err := utils.EncryptEnvelope(publicKey, kubeconfigData)
+	if err != nil {
+		return err
+	}
+
+	req.Kubeconfig = base64.StdEncoding.EncodeToString(ciphertext)
+	req.Encryption = &request.KubeconfigEncryption{
+		Algorithm:    constants.KubeconfigEncryptionAlgorithm,
+		KeyID:        keyID,
+		EncryptedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+	}
+	req.Fingerprints = &request.KubeconfigFingerprints{
+		CA:                fingerprint.CA,
+		ClientCertificate: fingerprint.ClientCertificate,
+		ClientUser:        fingerprint.ClientUser,
+		ClientNotBefore:   fingerprint.ClientNotBefore,
+		ClientNotAfter:    fingerprint.ClientNotAfter,
+	}
+
+	return nil
+}
+
+// storeKubeconfigInBarbican writes the kubeconfig to a new Barbican secret.
+// Earlier secrets are kept so previous kubeconfigs stay retrievable.
+func (a *appService) storeKubeconfigInBarbican(kubeconfig *clientcmdapi.Config, kubeconfigData []byte) (string, error) {
+	vkeConfig := config.GlobalConfig.GetVKEConfig()
+	kubeconfigConfig := config.GlobalConfig.GetKubeconfigConfig()
+
+	cert, err := kubeconfigClientCertificate(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+
+	providerClient, err := a.getLatestProviderClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to get openstack session: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	name := fmt.Sprintf("%s-%s-%s", kubeconfigConfig.BarbicanSecretPrefix, vkeConfig.ClusterID, time.Now().UTC().Format("20060102T150405Z"))
+	metadata := map[string]string{
+		"cluster_id":  vkeConfig.ClusterID,
+		"expires_at":  cert.NotAfter.UTC().Format(time.RFC3339),
+		"fingerprint": hex.EncodeToString(fingerprint[:]),
+	}
+
+	secretRef, err := a.iKeyManagerService.CreateSecret(providerClient, vkeConfig.Region, name, kubeconfigData, metadata)
+	if err != nil {
+		return "", err
+	}
+
+	klog.V(0).InfoS("Kubeconfig stored in Barbican",
+		"cluster_id", vkeConfig.ClusterID,
+		"secret_ref", secretRef,
+		"expires_at", cert.NotAfter,
+		"component", "kubeconfig")
+
+	return secretRef, nil
+}
+
+// verifyKubeconfig checks that the endpoint's serving certificate chains to
+// the kubeconfig's CA and covers the endpoint, then uses the kubeconfig to
+// read the server version and to confirm it is authorized to read the
+// cluster. Admin credentials can be issued for any KUBECONFIG_ADMIN_GROUPS,
+// so the check does not require cluster-admin.
+func verifyKubeconfig(ctx context.Context, kubeconfig *clientcmdapi.Config, clusterEndpoint string) error {
+	kubeCluster, _, err := currentKubeconfigEntries(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyServingCertificate(clusterEndpoint, kubeCluster.CertificateAuthorityData); err != nil {
+		return err
+	}
+
+	restConfig, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build client config: %v", err)
+	}
+	restConfig.Timeout = kubeconfigVerifyInterval
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to build client: %v", err)
+	}
+
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("failed to get server version: %v", err)
+	}
+
+	review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:     "list",
+				Resource: "namespaces",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create self subject access review: %v", err)
+	}
+
+	if !review.Status.Allowed {
+		return fmt.Errorf("kubeconfig user cannot list namespaces: %s", review.Status.Reason)
+	}
+
+	return nil
+}
+
+// verifyServingCertificate connects to the API endpoint and checks its
+// certificate against the CA data and the endpoint name.
+func verifyServingCertificate(clusterEndpoint string, caData []byte) error {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return fmt.Errorf("kubeconfig has no valid certificate authority data")
+	}
+
+	address := net.JoinHostPort(clusterEndpoint, strconv.Itoa(constants.KubeAPIServerPort))
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: kubeconfigVerifyInterval}, "tcp", address, &tls.Config{
+		// The chain and the name are verified below against the kubeconfig CA.
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	defer conn.Close()
+
+	peerCertificates := conn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return fmt.Errorf("%s presented no certificate", address)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range peerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	leaf := peerCertificates[0]
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return fmt.Errorf("serving certificate of %s does not chain to the kubeconfig CA: %v", address, err)
+	}
+
+	if err := leaf.VerifyHostname(clusterEndpoint); err != nil {
+		return fmt.Errorf("serving certificate of %s does not cover the endpoint: %v", address, err)
+	}
+
+	return nil
+}
+
+func kubeconfigClientCertificate(kubeconfig *clientcmdapi.Config) (*x509.Certificate, error) {
+	_, authInfo, err := currentKubeconfigEntries(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := parseCertificates(authInfo.ClientCertificateData)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("kubeconfig has no client certificate")
+	}
+
+	return certs[0], nil
+}
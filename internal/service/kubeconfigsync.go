@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+type kubeconfigFingerprint struct {
+	CA                string
+	ClientCertificate string
+	ClientUser        string
+	ClientNotBefore   time.Time
+	ClientNotAfter    time.Time
+}
+
+// SyncKubeconfig compares the CA and client certificate of the local admin
+// kubeconfig with the kubeconfig VKE holds and uploads the local one when
+// they differ. When a dedicated admin certificate is minted, the client
+// certificate is instead checked for its user and remaining lifetime. Only
+// the first master acts.
+func (a *appService) SyncKubeconfig() error {
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	vkeURL := config.GlobalConfig.GetVKEConfig().VKEURL
+
+	isFirstMaster, err := a.isFirstMasterNode()
+	if err != nil {
+		return err
+	}
+
+	if !isFirstMaster {
+		return nil
+	}
+
+	token := a.getLatestToken()
+	cluster, err := a.iVKEClusterService.GetCluster(clID, token, vkeURL)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster: %v", err)
+	}
+
+	if cluster.Data.ClusterStatus != constants.ClusterStatusActive {
+		klog.V(2).InfoS("Cluster is not active, skipping kubeconfig drift check",
+			"cluster_id", clID,
+			"status", cluster.Data.ClusterStatus,
+			"component", "kubeconfig_sync")
+		return nil
+	}
+
+	kubeconfigData, err := os.ReadFile(a.distribution.AdminKubeconfigPath())
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+
+	local, err := rewriteKubeconfig(kubeconfigData, cluster.Data.ClusterName,
+		fmt.Sprintf("https://%s:%d", cluster.Data.ClusterEndpoint, constants.KubeAPIServerPort))
+	if err != nil {
+		return fmt.Errorf("failed to rewrite kubeconfig: %v", err)
+	}
+
+	localFingerprint, err := kubeconfigFingerprints(local)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint local kubeconfig: %v", err)
+	}
+
+	remote, err := a.iVKEClusterService.GetKubeconfig(clID, token, vkeURL)
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig from VKE: %v", err)
+	}
+
+	kubeconfigConfig := config.GlobalConfig.GetKubeconfigConfig()
+	drift := "VKE holds no kubeconfig"
+	if remote != nil {
+		remoteFingerprint, err := remoteKubeconfigFingerprints(remote)
+		switch {
+		case err != nil:
+			drift = fmt.Sprintf("kubeconfig in VKE is unreadable: %v", err)
+		case kubeconfigConfig.EncryptionEnabled && remote.Data.Encryption == nil:
+			drift = "kubeconfig in VKE is not encrypted"
+		case !kubeconfigConfig.EncryptionEnabled && remote.Data.Encryption != nil:
+			drift = "kubeconfig in VKE is encrypted but encryption is disabled"
+		case kubeconfigConfig.EncryptionEnabled && !encryptedForConfiguredKey(remote.Data.Encryption):
+			drift = "kubeconfig is encrypted for a different key"
+		case remoteFingerprint.CA != localFingerprint.CA:
+			drift = "certificate authority differs"
+		case kubeconfigConfig.AdminCSREnabled && remoteFingerprint.ClientUser != kubeconfigConfig.AdminUser:
+			drift = fmt.Sprintf("client certificate is issued to %q instead of %q", remoteFingerprint.ClientUser, kubeconfigConfig.AdminUser)
+		case kubeconfigConfig.AdminCSREnabled && adminCertificateDue(remoteFingerprint, a.clock.DecisionTime()):
+			drift = fmt.Sprintf("client certificate expires at %s", remoteFingerprint.ClientNotAfter.Format(time.RFC3339))
+		case !kubeconfigConfig.AdminCSREnabled && remoteFingerprint.ClientCertificate != localFingerprint.ClientCertificate:
+			drift = "client certificate differs"
+		default:
+			klog.V(4).InfoS("Kubeconfig in VKE is in sync",
+				"cluster_id", clID,
+				"component", "kubeconfig_sync")
+			return nil
+		}
+	}
+
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	// Drift is still reported while paused, the credential is not re-minted
+	// or uploaded.
+	if a.checkPaused(constants.ActionKubeconfigUpload, currentNode) != nil {
+		klog.Warningf("Kubeconfig drift detected while paused - cluster_id: %s, reason: %s", clID, drift)
+		return nil
+	}
+
+	klog.Warningf("Kubeconfig drift detected, re-uploading - cluster_id: %s, reason: %s", clID, drift)
+	a.eventRecorder.Eventf(currentNode, v1.EventTypeWarning, constants.EventReasonKubeconfigDrift,
+		"Kubeconfig in VKE is out of date (%s), re-uploading", drift)
+
+	if kubeconfigConfig.AdminCSREnabled {
+		local, err = a.mintAdminKubeconfig(local)
+		if err != nil {
+			return fmt.Errorf("failed to mint admin kubeconfig: %v", err)
+		}
+	}
+
+	return a.uploadKubeconfig(local, cluster.Data.ClusterEndpoint)
+}
+
+// adminCertificateDue reports whether a minted admin certificate has less
+// than a tenth of its lifetime left.
+func adminCertificateDue(fingerprint kubeconfigFingerprint, now time.Time) bool {
+	lifetime := fingerprint.ClientNotAfter.Sub(fingerprint.ClientNotBefore)
+	return fingerprint.ClientNotAfter.Sub(now) < lifetime/10
+}
+
+// recordKubeconfigUpload keeps the time and fingerprints of the last upload
+// on the node that uploaded it and emits an event.
+func (a *appService) recordKubeconfigUpload(kubeconfig *clientcmdapi.Config) error {
+	fingerprint, err := kubeconfigFingerprints(kubeconfig)
+	if err != nil {
+		return err
+	}
+
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				constants.KubeconfigUploadedAtAnnotation:      a.clock.Now().UTC().Format(time.RFC3339),
+				constants.KubeconfigCAFingerprintAnnotation:   fingerprint.CA,
+				constants.KubeconfigCertFingerprintAnnotation: fingerprint.ClientCertificate,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build upload patch: %v", err)
+	}
+
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), currentNode.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record kubeconfig upload: %v", err)
+	}
+
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonKubeconfigUploaded,
+		"Uploaded kubeconfig to VKE (ca sha256 %s, client certificate sha256 %s)", fingerprint.CA, fingerprint.ClientCertificate)
+
+	return nil
+}
+
+// remoteKubeconfigFingerprints returns the fingerprints of the kubeconfig VKE
+// holds. Encrypted kubeconfigs cannot be read here, so the fingerprints
+// uploaded along with them are used instead.
+func remoteKubeconfigFingerprints(remote *resource.VKEKubeconfigResponse) (kubeconfigFingerprint, error) {
+	if remote.Data.Encryption != nil {
+		if remote.Data.Fingerprints == nil {
+			return kubeconfigFingerprint{}, fmt.Errorf("encrypted kubeconfig has no fingerprints")
+		}
+		return kubeconfigFingerprint{
+			CA:                remote.Data.Fingerprints.CA,
+			ClientCertificate: remote.Data.Fingerprints.ClientCertificate,
+			ClientUser:        remote.Data.Fingerprints.ClientUser,
+			ClientNotBefore:   remote.Data.Fingerprints.ClientNotBefore,
+			ClientNotAfter:    remote.Data.Fingerprints.ClientNotAfter,
+		}, nil
+	}
+
+	kubeconfigData, err := base64.StdEncoding.DecodeString(remote.Data.Kubeconfig)
+	if err != nil {
+		return kubeconfigFingerprint{}, fmt.Errorf("invalid base64: %v", err)
+	}
+
+	kubeconfig, err := clientcmd.Load(kubeconfigData)
+	if err != nil {
+		return kubeconfigFingerprint{}, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+
+	return kubeconfigFingerprints(kubeconfig)
+}
+
+// encryptedForConfiguredKey reports whether the kubeconfig was sealed for the
+// currently configured public key.
+func encryptedForConfiguredKey(encryption *resource.KubeconfigEncryption) bool {
+	publicKey := config.GlobalConfig.GetKubeconfigConfig().EncryptionPublicKey
+	if publicKey == nil {
+		return false
+	}
+
+	keyID, err := utils.PublicKeyID(publicKey)
+	if err != nil {
+		return false
+	}
+
+	return encryption.KeyID == keyID && encryption.Algorithm == constants.KubeconfigEncryptionAlgorithm
+}
+
+// kubeconfigFingerprints returns the SHA-256 fingerprints of the CA and the
+// client certificate of the kubeconfig's current context.
+func kubeconfigFingerprints(kubeconfig *clientcmdapi.Config) (kubeconfigFingerprint, error) {
+	kubeCluster, authInfo, err := currentKubeconfigEntries(kubeconfig)
+	if err != nil {
+		return kubeconfigFingerprint{}, err
+	}
+
+	caCerts := parseCertificates(kubeCluster.CertificateAuthorityData)
+	if len(caCerts) == 0 {
+		return kubeconfigFingerprint{}, fmt.Errorf("kubeconfig has no certificate authority")
+	}
+
+	clientCerts := parseCertificates(authInfo.ClientCertificateData)
+	if len(clientCerts) == 0 {
+		return kubeconfigFingerprint{}, fmt.Errorf("kubeconfig has no client certificate")
+	}
+
+	caSum := sha256.Sum256(caCerts[0].Raw)
+	clientSum := sha256.Sum256(clientCerts[0].Raw)
+	return kubeconfigFingerprint{
+		CA:                hex.EncodeToString(caSum[:]),
+		ClientCertificate: hex.EncodeToString(clientSum[:]),
+		ClientUser:        clientCerts[0].Subject.CommonName,
+		ClientNotBefore:   clientCerts[0].NotBefore,
+		ClientNotAfter:    clientCerts[0].NotAfter,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/klog/v2"
+)
+
+type ILoadbalancerService interface {
+	GetLoadbalancer(providerClient *gophercloud.ProviderClient, region, loadbalancerID string) (*loadbalancers.LoadBalancer, error)
+	ListListeners(providerClient *gophercloud.ProviderClient, region, loadbalancerID string) ([]listeners.Listener, error)
+	GetPool(providerClient *gophercloud.ProviderClient, region, poolID string) (*pools.Pool, error)
+	ListPoolMembers(providerClient *gophercloud.ProviderClient, region, poolID string) ([]pools.Member, error)
+	CreatePoolMember(providerClient *gophercloud.ProviderClient, region, poolID string, opts pools.CreateMemberOpts) (*pools.Member, error)
+	DeletePoolMember(providerClient *gophercloud.ProviderClient, region, poolID, memberID string) error
+	UpdateListenerAllowedCIDRs(providerClient *gophercloud.ProviderClient, region, listenerID string, allowedCIDRs []string) (*listeners.Listener, error)
+}
+
+type loadbalancerService struct{}
+
+func NewLoadbalancerService() ILoadbalancerService {
+	return &loadbalancerService{}
+}
+
+func newLoadbalancerClient(providerClient *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	client, err := openstack.NewLoadBalancerV2(providerClient, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("error creating load balancer client: %v", err)
+	}
+	return client, nil
+}
+
+func (l *loadbalancerService) GetLoadbalancer(providerClient *gophercloud.ProviderClient, region, loadbalancerID string) (*loadbalancers.LoadBalancer, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	lb, err := loadbalancers.Get(client, loadbalancerID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get load balancer - loadbalancer_id: %s, error: %v", loadbalancerID, err)
+		return nil, err
+	}
+
+	return lb, nil
+}
+
+func (l *loadbalancerService) ListListeners(providerClient *gophercloud.ProviderClient, region, loadbalancerID string) ([]listeners.Listener, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := listeners.List(client, listeners.ListOpts{LoadbalancerID: loadbalancerID}).AllPages()
+	if err != nil {
+		klog.Errorf("Failed to list listeners - loadbalancer_id: %s, error: %v", loadbalancerID, err)
+		return nil, err
+	}
+
+	return listeners.ExtractListeners(pages)
+}
+
+func (l *loadbalancerService) GetPool(providerClient *gophercloud.ProviderClient, region, poolID string) (*pools.Pool, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pools.Get(client, poolID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get pool - pool_id: %s, error: %v", poolID, err)
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+func (l *loadbalancerService) ListPoolMembers(providerClient *gophercloud.ProviderClient, region, poolID string) ([]pools.Member, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := pools.ListMembers(client, poolID, pools.ListMembersOpts{}).AllPages()
+	if err != nil {
+		klog.Errorf("Failed to list pool members - pool_id: %s, error: %v", poolID, err)
+		return nil, err
+	}
+
+	return pools.ExtractMembers(pages)
+}
+
+func (l *loadbalancerService) CreatePoolMember(providerClient *gophercloud.ProviderClient, region, poolID string, opts pools.CreateMemberOpts) (*pools.Member, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := pools.CreateMember(client, poolID, opts).Extract()
+	if err != nil {
+		klog.Errorf("Failed to create pool member - pool_id: %s, address: %s, port: %d, error: %v",
+			poolID, opts.Address, opts.ProtocolPort, err)
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (l *loadbalancerService) DeletePoolMember(providerClient *gophercloud.ProviderClient, region, poolID, memberID string) error {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return err
+	}
+
+	if err := pools.DeleteMember(client, poolID, memberID).ExtractErr(); err != nil {
+		klog.Errorf("Failed to delete pool member - pool_id: %s, member_id: %s, error: %v", poolID, memberID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (l *loadbalancerService) UpdateListenerAllowedCIDRs(providerClient *gophercloud.ProviderClient, region, listenerID string, allowedCIDRs []string) (*listeners.Listener, error) {
+	client, err := newLoadbalancerClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty list, not null, removes the restriction.
+	if allowedCIDRs == nil {
+		allowedCIDRs = []string{}
+	}
+
+	listener, err := listeners.Update(client, listenerID, listeners.UpdateOpts{AllowedCIDRs: &allowedCIDRs}).Extract()
+	if err != nil {
+		klog.Errorf("Failed to update listener allowed cidrs - listener_id: %s, error: %v", listenerID, err)
+		return nil, err
+	}
+
+	return listener, nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/maintenance"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// ErrOutsideMaintenanceWindow is returned when a disruptive action is not
+	// started because no maintenance window allows it right now.
+	ErrOutsideMaintenanceWindow = errors.New("outside maintenance window")
+	// ErrChangeFreeze is returned when a disruptive action is not started
+	// because a change freeze is in effect.
+	ErrChangeFreeze = errors.New("change freeze in effect")
+)
+
+// IsRenewalDeferred reports whether err only means that the renewal has to
+// wait, for a maintenance window, a change freeze to end, an approval or the
+// pause to be lifted.
+func IsRenewalDeferred(err error) bool {
+	return errors.Is(err, ErrOutsideMaintenanceWindow) || errors.Is(err, ErrChangeFreeze) ||
+		errors.Is(err, ErrAwaitingApproval) || errors.Is(err, ErrPaused)
+}
+
+// vkeSchedule keeps the change freezes VKE announced for the cluster. The
+// certificate check that fetches them runs in its own goroutine.
+type vkeSchedule struct {
+	mu      sync.Mutex
+	freezes []maintenance.Freeze
+}
+
+// rememberVKESchedule stores the freezes VKE announced for the cluster.
+func (a *appService) rememberVKESchedule(cluster *resource.VKEClusterResponse) {
+	freezes := make([]maintenance.Freeze, 0, len(cluster.Data.ClusterFreezePeriods))
+	for _, period := range cluster.Data.ClusterFreezePeriods {
+		freezes = append(freezes, maintenance.Freeze{Name: period.Name, Start: period.Start, End: period.End})
+	}
+
+	a.schedule.mu.Lock()
+	defer a.schedule.mu.Unlock()
+	a.schedule.freezes = freezes
+}
+
+func (a *appService) scheduledFreezes(maintenanceConfig config.MaintenanceConfig) []maintenance.Freeze {
+	a.schedule.mu.Lock()
+	defer a.schedule.mu.Unlock()
+	return append(append([]maintenance.Freeze{}, maintenanceConfig.Freezes...), a.schedule.freezes...)
+}
+
+// checkDisruptionAllowed returns nil when action may start now and finish,
+// duration later, inside a maintenance window. Change freezes are checked
+// first. A renewal that cannot wait for the freeze to end, because the
+// certificates expiring at certificateExpiry would expire before that, is
+// allowed once it is within the emergency threshold of the expiry; emergency
+// then reports that the freeze and the maintenance windows were overridden.
+// Actions unrelated to certificates pass a zero certificateExpiry.
+func (a *appService) checkDisruptionAllowed(action string, duration time.Duration, certificateExpiry time.Time) (emergency bool, err error) {
+	maintenanceConfig := config.GlobalConfig.GetMaintenanceConfig()
+	freezes := a.scheduledFreezes(maintenanceConfig)
+
+	now := a.clock.Now()
+	freeze, frozen := maintenance.ActiveFreeze(freezes, now)
+	if !frozen {
+		return false, a.checkMaintenanceWindow(action, duration)
+	}
+
+	if !maintenanceConfig.EmergencyOverride || certificateExpiry.IsZero() {
+		return false, fmt.Errorf("%w: %s during %s", ErrChangeFreeze, action, freeze)
+	}
+
+	// The expiry is compared with the decision time, so a simulated clock
+	// rehearses the override like it rehearses the renewal itself.
+	untilExpiry := certificateExpiry.Sub(a.clock.DecisionTime())
+	if untilExpiry >= freeze.End.Sub(now) {
+		return false, fmt.Errorf("%w: %s during %s", ErrChangeFreeze, action, freeze)
+	}
+	// The message only names fixed times, so the deferral events of
+	// successive checks are identical and deduplicated.
+	if untilExpiry > maintenanceConfig.EmergencyThreshold {
+		return false, fmt.Errorf("%w: %s during %s, certificates expire at %s so an emergency renewal starts %s before that",
+			ErrChangeFreeze, action, freeze, certificateExpiry.Format(time.RFC3339), maintenanceConfig.EmergencyThreshold)
+	}
+
+	klog.Warningf("Overriding change freeze - action: %s, freeze: %s, certificates expire in: %s",
+		action, freeze, untilExpiry.Round(time.Minute))
+	return true, nil
+}
+
+// deferralReason returns the event reason for an error returned by
+// checkDisruptionAllowed.
+func deferralReason(err error) string {
+	if errors.Is(err, ErrChangeFreeze) {
+		return constants.EventReasonChangeFreeze
+	}
+	return constants.EventReasonOutsideMaintenance
+}
+
+// checkMaintenanceWindow returns nil when action may start now and is
+// expected to finish, duration later, before the current window closes.
+// Otherwise it wraps ErrOutsideMaintenanceWindow with the next window.
+func (a *appService) checkMaintenanceWindow(action string, duration time.Duration) error {
+	maintenanceConfig := config.GlobalConfig.GetMaintenanceConfig()
+	windows := maintenanceConfig.WindowsFor(action)
+	if len(windows) == 0 {
+		return nil
+	}
+
+	now := a.clock.Now().In(maintenanceConfig.Location)
+	if end, ok := maintenance.Active(windows, now); ok {
+		if !now.Add(duration).After(end) {
+			return nil
+		}
+		return fmt.Errorf("%w: %s takes %s but the window closes at %s, next window %s",
+			ErrOutsideMaintenanceWindow, action, duration, end.Format(time.RFC3339),
+			nextMaintenanceWindow(windows, now, duration))
+	}
+
+	return fmt.Errorf("%w: %s, next window %s", ErrOutsideMaintenanceWindow, action, nextMaintenanceWindow(windows, now, duration))
+}
+
+// waitForDisruptionAllowed blocks until action may start on node and reports
+// whether a change freeze was overridden. Every recheck that defers the
+// action is recorded on node.
+func (a *appService) waitForDisruptionAllowed(node *v1.Node, action string, duration time.Duration, certificateExpiry time.Time) bool {
+	for {
+		health.Heartbeat()
+		emergency, err := a.checkDisruptionAllowed(action, duration, certificateExpiry)
+		if err == nil {
+			return emergency
+		}
+
+		maintenanceConfig := config.GlobalConfig.GetMaintenanceConfig()
+		now := a.clock.Now().In(maintenanceConfig.Location)
+		wait := time.Hour
+		if start, _, ok := maintenance.Next(maintenanceConfig.WindowsFor(action), now); ok && start.Sub(now) < wait {
+			wait = start.Sub(now)
+		}
+
+		klog.V(0).InfoS("Waiting before disruptive action",
+			"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+			"action", action,
+			"reason", err.Error(),
+			"recheck_in", wait.Round(time.Second),
+			"component", "maintenance")
+		a.recordStep(node, v1.EventTypeNormal, deferralReason(err), "Skipped %s: %v", action, err)
+		time.Sleep(wait)
+	}
+}
+
+// nextMaintenanceWindow describes the next window long enough for an action
+// taking duration.
+func nextMaintenanceWindow(windows []maintenance.Window, now time.Time, duration time.Duration) string {
+	from := now
+	for i := 0; i < 7*len(windows)+1; i++ {
+		start, end, ok := maintenance.Next(windows, from)
+		if !ok {
+			break
+		}
+		if !start.Add(duration).After(end) {
+			return fmt.Sprintf("opens at %s", start.Format(time.RFC3339))
+		}
+		from = start
+	}
+	return "none long enough"
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"k8s.io/klog/v2"
+)
+
+const (
+	metadataServiceURL  = "http://169.254.169.254/openstack/latest/meta_data.json"
+	configDriveMetadata = "openstack/latest/meta_data.json"
+)
+
+type IMetadataService interface {
+	GetInstanceMetadata(configDrivePath string) (*model.InstanceMetadata, error)
+}
+
+type metadataService struct{}
+
+func NewMetadataService() IMetadataService {
+	return &metadataService{}
+}
+
+// GetInstanceMetadata reads meta_data.json from the config drive mounted at
+// configDrivePath and falls back to the metadata service when no config
+// drive is available.
+func (m *metadataService) GetInstanceMetadata(configDrivePath string) (*model.InstanceMetadata, error) {
+	if configDrivePath != "" {
+		data, err := os.ReadFile(filepath.Join(configDrivePath, configDriveMetadata))
+		if err == nil {
+			return decodeInstanceMetadata(data)
+		}
+		klog.V(2).Infof("Config drive metadata not readable, falling back to metadata service - path: %s, error: %v",
+			configDrivePath, err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(metadataServiceURL)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	return decodeInstanceMetadata(data)
+}
+
+func decodeInstanceMetadata(data []byte) (*model.InstanceMetadata, error) {
+	var metadata model.InstanceMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("error decoding instance metadata: %v", err)
+	}
+
+	if metadata.UUID == "" {
+		return nil, fmt.Errorf("instance metadata has no uuid")
+	}
+
+	return &metadata, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/klog/v2"
+)
+
+type INetworkService interface {
+	GetSubnet(providerClient *gophercloud.ProviderClient, region, subnetID string) (*subnets.Subnet, error)
+}
+
+type networkService struct{}
+
+func NewNetworkService() INetworkService {
+	return &networkService{}
+}
+
+func newNetworkClient(providerClient *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	client, err := openstack.NewNetworkV2(providerClient, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("error creating network client: %v", err)
+	}
+	return client, nil
+}
+
+func (n *networkService) GetSubnet(providerClient *gophercloud.ProviderClient, region, subnetID string) (*subnets.Subnet, error) {
+	client, err := newNetworkClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	subnet, err := subnets.Get(client, subnetID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get subnet - subnet_id: %s, error: %v", subnetID, err)
+		return nil, err
+	}
+
+	return subnet, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+	"k8s.io/klog/v2"
+)
+
+type IObjectStorageService interface {
+	EnsureContainer(providerClient *gophercloud.ProviderClient, region, container string) error
+	UploadObject(providerClient *gophercloud.ProviderClient, region, container, name string, data []byte, metadata map[string]string) error
+	ListObjects(providerClient *gophercloud.ProviderClient, region, container, prefix string) ([]objects.Object, error)
+	DownloadObject(providerClient *gophercloud.ProviderClient, region, container, name string) ([]byte, error)
+	DeleteObject(providerClient *gophercloud.ProviderClient, region, container, name string) error
+}
+
+type objectStorageService struct{}
+
+func NewObjectStorageService() IObjectStorageService {
+	return &objectStorageService{}
+}
+
+func newObjectStorageClient(providerClient *gophercloud.ProviderClient, region string) (*gophercloud.ServiceClient, error) {
+	client, err := openstack.NewObjectStorageV1(providerClient, gophercloud.EndpointOpts{Region: region})
+	if err != nil {
+		return nil, fmt.Errorf("error creating object storage client: %v", err)
+	}
+	return client, nil
+}
+
+func (o *objectStorageService) EnsureContainer(providerClient *gophercloud.ProviderClient, region, container string) error {
+	client, err := newObjectStorageClient(providerClient, region)
+	if err != nil {
+		return err
+	}
+
+	if _, err := containers.Create(client, container, nil).Extract(); err != nil {
+		klog.Errorf("Failed to create container - container: %s, error: %v", container, err)
+		return err
+	}
+
+	return nil
+}
+
+func (o *objectStorageService) UploadObject(providerClient *gophercloud.ProviderClient, region, container, name string, data []byte, metadata map[string]string) error {
+	client, err := newObjectStorageClient(providerClient, region)
+	if err != nil {
+		return err
+	}
+
+	opts := objects.CreateOpts{
+		Content:     bytes.NewReader(data),
+		ContentType: "application/octet-stream",
+		Metadata:    metadata,
+	}
+	if _, err := objects.Create(client, container, name, opts).Extract(); err != nil {
+		klog.Errorf("Failed to upload object - container: %s, object: %s, error: %v", container, name, err)
+		return err
+	}
+
+	return nil
+}
+
+func (o *objectStorageService) ListObjects(providerClient *gophercloud.ProviderClient, region, container, prefix string) ([]objects.Object, error) {
+	client, err := newObjectStorageClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := objects.List(client, container, objects.ListOpts{Full: true, Prefix: prefix}).AllPages()
+	if err != nil {
+		klog.Errorf("Failed to list objects - container: %s, prefix: %s, error: %v", container, prefix, err)
+		return nil, err
+	}
+
+	return objects.ExtractInfo(pages)
+}
+
+func (o *objectStorageService) DownloadObject(providerClient *gophercloud.ProviderClient, region, container, name string) ([]byte, error) {
+	client, err := newObjectStorageClient(providerClient, region)
+	if err != nil {
+		return nil, err
+	}
+
+	result := objects.Download(client, container, name, nil)
+	data, err := result.ExtractContent()
+	if err != nil {
+		klog.Errorf("Failed to download object - container: %s, object: %s, error: %v", container, name, err)
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (o *objectStorageService) DeleteObject(providerClient *gophercloud.ProviderClient, region, container, name string) error {
+	client, err := newObjectStorageClient(providerClient, region)
+	if err != nil {
+		return err
+	}
+
+	if _, err := objects.Delete(client, container, name, nil).Extract(); err != nil {
+		klog.Errorf("Failed to delete object - container: %s, object: %s, error: %v", container, name, err)
+		return err
+	}
+
+	return nil
+}
@@ -2,16 +2,22 @@ package service
 
 import (
 	"crypto/tls"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
 	"k8s.io/klog/v2"
 )
 
 type IOpenstackService interface {
 	ValidateAndCreateSession(pjID, applicationCredentialID, applicationCredentialSecret, identityURL string) (*gophercloud.ProviderClient, error)
+	GetApplicationCredential(providerClient *gophercloud.ProviderClient, applicationCredentialID string) (*applicationcredentials.ApplicationCredential, error)
 }
 
 type openstackService struct {
@@ -49,12 +55,41 @@ func (o *openstackService) ValidateAndCreateSession(pjID, applicationCredentialI
 	}
 	providerClient.HTTPClient = *client
 
+	start := time.Now()
 	err = openstack.Authenticate(providerClient, authOpts)
+	metrics.ObserveKeystoneRequest(start, err)
 	if err != nil {
 		klog.Errorf("OpenStack authentication failed - identityURL: %s, projectID: %s, applicationCredentialID: %s, error: %v",
 			identityURL, pjID, applicationCredentialID, err)
 		return nil, err
 	}
+	health.RecordSuccess(health.DependencyKeystone)
 
 	return providerClient, nil
 }
+
+func (o *openstackService) GetApplicationCredential(providerClient *gophercloud.ProviderClient, applicationCredentialID string) (*applicationcredentials.ApplicationCredential, error) {
+	authResult, ok := providerClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return nil, fmt.Errorf("provider client has no keystone v3 auth result")
+	}
+
+	user, err := authResult.ExtractUser()
+	if err != nil {
+		return nil, fmt.Errorf("error extracting token user: %v", err)
+	}
+
+	identityClient, err := openstack.NewIdentityV3(providerClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %v", err)
+	}
+
+	applicationCredential, err := applicationcredentials.Get(identityClient, user.ID, applicationCredentialID).Extract()
+	if err != nil {
+		klog.Errorf("Failed to get application credential - applicationCredentialID: %s, userID: %s, error: %v",
+			applicationCredentialID, user.ID, err)
+		return nil, err
+	}
+
+	return applicationCredential, nil
+}
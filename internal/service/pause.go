@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ErrPaused is returned when a disruptive action is skipped because the
+// agent is paused.
+var ErrPaused = errors.New("disruptive actions are paused")
+
+// pauseReason reports whether disruptive actions are paused, either through
+// MAINTENANCE_PAUSED or through the paused annotation on the agent's
+// ConfigMap. When the ConfigMap cannot be read the agent stays paused, a
+// pause set during an incident must not be missed because of it.
+func (a *appService) pauseReason() (string, bool) {
+	if config.GlobalConfig.GetMaintenanceConfig().Paused {
+		return "MAINTENANCE_PAUSED is set", true
+	}
+
+	webConfig := config.GlobalConfig.GetWebConfig()
+	configMap, err := a.k8sClient.CoreV1().ConfigMaps(webConfig.Namespace).Get(context.Background(), webConfig.ConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", false
+	}
+	if err != nil {
+		return fmt.Sprintf("pause annotation on ConfigMap %s/%s cannot be read: %v", webConfig.Namespace, webConfig.ConfigMapName, err), true
+	}
+
+	paused, _ := strconv.ParseBool(configMap.Annotations[constants.PausedAnnotation])
+	if paused {
+		return fmt.Sprintf("ConfigMap %s/%s is annotated with %s", webConfig.Namespace, webConfig.ConfigMapName, constants.PausedAnnotation), true
+	}
+	return "", false
+}
+
+// checkPaused returns a wrapped ErrPaused, after logging it and recording
+// the skipped step on node, when action has to be skipped because of the
+// pause.
+func (a *appService) checkPaused(action string, node *v1.Node) error {
+	reason, paused := a.pauseReason()
+	if !paused {
+		return nil
+	}
+
+	klog.V(0).InfoS("Skipping disruptive action, agent is paused",
+		"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+		"action", action,
+		"reason", reason,
+		"component", "pause")
+	a.recordStep(node, v1.EventTypeWarning, constants.EventReasonDisruptionPaused,
+		"Skipped %s: %s", action, reason)
+
+	return fmt.Errorf("%w: %s", ErrPaused, reason)
+}
+
+// waitUntilUnpaused blocks while the agent is paused, for actions that
+// cannot be retried later.
+func (a *appService) waitUntilUnpaused(action string, node *v1.Node) {
+	if a.checkPaused(action, node) == nil {
+		return
+	}
+
+	for {
+		health.Heartbeat()
+		time.Sleep(constants.PauseRecheckInterval)
+		if _, paused := a.pauseReason(); !paused {
+			klog.V(0).InfoS("Agent is no longer paused, resuming",
+				"cluster_id", config.GlobalConfig.GetVKEConfig().ClusterID,
+				"action", action,
+				"component", "pause")
+			return
+		}
+	}
+}
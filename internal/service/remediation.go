@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// notReadyNode is a node due for remediation and the start of its outage.
+type notReadyNode struct {
+	node  *v1.Node
+	since time.Time
+}
+
+// RemediateNotReadyNodes reboots the Nova servers behind nodes that stayed
+// NotReady for longer than the configured timeout. A node is soft-rebooted
+// first and hard-rebooted if that did not help. When more nodes than
+// REMEDIATION_MAX_UNHEALTHY_NODES are due, the cause is most likely shared,
+// such as a partition or the API load balancer, and nothing is rebooted.
+// Only the first master acts.
+func (a *appService) RemediateNotReadyNodes() error {
+	remediationConfig := config.GlobalConfig.GetRemediationConfig()
+	if !remediationConfig.Enabled {
+		return nil
+	}
+
+	isFirstMaster, err := a.isFirstMasterNode()
+	if err != nil {
+		return err
+	}
+
+	if !isFirstMaster {
+		return nil
+	}
+
+	nodes, err := a.k8sClient.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	now := time.Now()
+	var unhealthy []notReadyNode
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+
+		notReadySince, err := a.trackNotReadySince(node)
+		if err != nil {
+			klog.ErrorS(err, "Failed to track NotReady node",
+				"node", node.Name,
+				"component", "node_remediator")
+			continue
+		}
+		if !notReadySince.IsZero() && now.Sub(notReadySince) >= remediationConfig.NotReadyTimeout {
+			unhealthy = append(unhealthy, notReadyNode{node: node, since: notReadySince})
+		}
+	}
+
+	if len(unhealthy) > remediationConfig.MaxUnhealthyNodes {
+		klog.Warningf("Too many NotReady nodes, skipping remediation - not_ready: %d, max: %d",
+			len(unhealthy), remediationConfig.MaxUnhealthyNodes)
+		if currentNode, err := getCurrentNode(a.k8sClient); err == nil {
+			a.recordStep(currentNode, v1.EventTypeWarning, constants.EventReasonNodeRemediationSkipped,
+				"Skipped remediation: %d nodes are NotReady, more than REMEDIATION_MAX_UNHEALTHY_NODES (%d)",
+				len(unhealthy), remediationConfig.MaxUnhealthyNodes)
+		}
+		return nil
+	}
+
+	var providerClient *gophercloud.ProviderClient
+	for _, candidate := range unhealthy {
+		node, notReadySince := candidate.node, candidate.since
+
+		if node.Name == os.Getenv("NODE_NAME") {
+			a.eventRecorder.Event(node, v1.EventTypeWarning, constants.EventReasonNodeRemediationSkipped,
+				"Node is NotReady but runs the remediating agent itself")
+			continue
+		}
+
+		method, due := nextRemediationAction(node, notReadySince, now, remediationConfig.NotReadyTimeout)
+		if !due {
+			continue
+		}
+
+		history := recentRemediationActions(node, now, remediationConfig.ActionWindow)
+		if len(history) >= remediationConfig.MaxActions {
+			klog.Warningf("Remediation limit reached - node: %s, actions: %d, window: %s",
+				node.Name, len(history), remediationConfig.ActionWindow)
+			a.eventRecorder.Eventf(node, v1.EventTypeWarning, constants.EventReasonNodeRemediationLimited,
+				"Node has been NotReady since %s but was already rebooted %d times within %s",
+				notReadySince.Format(time.RFC3339), len(history), remediationConfig.ActionWindow)
+			continue
+		}
+
+		if a.checkPaused(constants.ActionRemediation, node) != nil {
+			continue
+		}
+
+		if _, err := a.checkDisruptionAllowed(constants.ActionRemediation, 0, time.Time{}); err != nil {
+			a.recordStep(node, v1.EventTypeWarning, constants.EventReasonNodeRemediationSkipped,
+				"Node has been NotReady since %s, reboot postponed: %v", notReadySince.Format(time.RFC3339), err)
+			continue
+		}
+
+		if providerClient == nil {
+			providerClient, err = a.getLatestProviderClient()
+			if err != nil {
+				return fmt.Errorf("failed to get openstack session: %v", err)
+			}
+		}
+
+		if err := a.rebootNode(providerClient, node, method, append(history, now)); err != nil {
+			klog.ErrorS(err, "Failed to remediate node",
+				"node", node.Name,
+				"method", method,
+				"component", "node_remediator")
+		}
+	}
+
+	return nil
+}
+
+func (a *appService) rebootNode(providerClient *gophercloud.ProviderClient, node *v1.Node, method servers.RebootMethod, history []time.Time) error {
+	serverID, err := serverIDFromProviderID(node.Spec.ProviderID)
+	if err != nil {
+		a.eventRecorder.Eventf(node, v1.EventTypeWarning, constants.EventReasonNodeRebootFailed,
+			"Cannot map node to a Nova server: %v", err)
+		return err
+	}
+
+	klog.V(0).InfoS("Rebooting NotReady node",
+		"node", node.Name,
+		"server_id", serverID,
+		"method", method,
+		"component", "node_remediator")
+
+	if err := a.iComputeService.RebootServer(providerClient, config.GlobalConfig.GetVKEConfig().Region, serverID, method); err != nil {
+		a.eventRecorder.Eventf(node, v1.EventTypeWarning, constants.EventReasonNodeRebootFailed,
+			"%s reboot of server %s failed: %v", strings.ToLower(string(method)), serverID, err)
+		return err
+	}
+
+	reason := constants.EventReasonNodeSoftRebooted
+	if method == servers.HardReboot {
+		reason = constants.EventReasonNodeHardRebooted
+	}
+	a.eventRecorder.Eventf(node, v1.EventTypeWarning, reason,
+		"Node was NotReady, requested %s reboot of server %s", strings.ToLower(string(method)), serverID)
+
+	return a.recordRemediationAction(node, method, history)
+}
+
+func (a *appService) recordRemediationAction(node *v1.Node, method servers.RebootMethod, history []time.Time) error {
+	timestamps := make([]string, 0, len(history))
+	for _, t := range history {
+		timestamps = append(timestamps, t.UTC().Format(time.RFC3339))
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				constants.RemediationLastActionAnnotation:     string(method),
+				constants.RemediationLastActionTimeAnnotation: history[len(history)-1].UTC().Format(time.RFC3339),
+				constants.RemediationHistoryAnnotation:        strings.Join(timestamps, ","),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build remediation patch: %v", err)
+	}
+
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record remediation on node %s: %v", node.Name, err)
+	}
+
+	return nil
+}
+
+// trackNotReadySince returns when the node's current outage started, zero
+// when it is Ready. The start is kept in an annotation owned by the agent:
+// the Ready condition's transition time cannot be used, a reboot moves it
+// from False to Unknown and back. The annotation is removed once the node is
+// Ready again.
+func (a *appService) trackNotReadySince(node *v1.Node) (time.Time, error) {
+	recorded, hasRecorded := node.Annotations[constants.RemediationNotReadySinceAnnotation]
+
+	if nodeReady(node) {
+		if !hasRecorded {
+			return time.Time{}, nil
+		}
+		return time.Time{}, a.patchNotReadySince(node, nil)
+	}
+
+	if since, err := time.Parse(time.RFC3339, recorded); err == nil {
+		return since, nil
+	}
+
+	since := time.Now().UTC()
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady && !condition.LastTransitionTime.IsZero() {
+			since = condition.LastTransitionTime.UTC()
+		}
+	}
+	value := since.Format(time.RFC3339)
+	if err := a.patchNotReadySince(node, &value); err != nil {
+		return time.Time{}, err
+	}
+	return since, nil
+}
+
+// patchNotReadySince sets the outage start annotation, or removes it when
+// value is nil.
+func (a *appService) patchNotReadySince(node *v1.Node, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{
+				constants.RemediationNotReadySinceAnnotation: value,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build outage patch: %v", err)
+	}
+
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), node.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record outage on node %s: %v", node.Name, err)
+	}
+	return nil
+}
+
+// nodeReady reports whether the node's Ready condition is True.
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nextRemediationAction decides how to reboot a node that has been NotReady
+// since notReadySince, the start of the outage tracked by the agent. Nodes
+// are soft-rebooted first. If the node is still NotReady a timeout after an
+// earlier reboot of the same outage, it is hard-rebooted.
+func nextRemediationAction(node *v1.Node, notReadySince, now time.Time, timeout time.Duration) (servers.RebootMethod, bool) {
+	lastAction := node.Annotations[constants.RemediationLastActionAnnotation]
+	lastActionTime, err := time.Parse(time.RFC3339, node.Annotations[constants.RemediationLastActionTimeAnnotation])
+	if lastAction == "" || err != nil || lastActionTime.Before(notReadySince) {
+		return servers.SoftReboot, true
+	}
+
+	if now.Sub(lastActionTime) < timeout {
+		return "", false
+	}
+
+	return servers.HardReboot, true
+}
+
+// recentRemediationActions returns the recorded reboots of the node that fall
+// within the action window.
+func recentRemediationActions(node *v1.Node, now time.Time, window time.Duration) []time.Time {
+	var recent []time.Time
+	for _, item := range strings.Split(node.Annotations[constants.RemediationHistoryAnnotation], ",") {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// serverIDFromProviderID extracts the Nova server ID from a provider ID of
+// the form openstack:///<server-id> or openstack://<region>/<server-id>.
+func serverIDFromProviderID(providerID string) (string, error) {
+	if !strings.HasPrefix(providerID, constants.OpenstackProviderIDPrefix) {
+		return "", fmt.Errorf("unsupported provider id %q", providerID)
+	}
+
+	serverID := providerID[strings.LastIndex(providerID, "/")+1:]
+	if serverID == "" {
+		return "", fmt.Errorf("provider id %q has no server id", providerID)
+	}
+
+	return serverID, nil
+}
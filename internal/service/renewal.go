@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// decideRenewal sorts the certificate expiry into a tier. Far from the
+// expiry the agent only warns, closer it schedules the renewal for the next
+// maintenance window and very close it renews right away.
+func decideRenewal(now, expireDate time.Time, renewalConfig config.RenewalConfig) model.RenewalDecision {
+	decision := model.RenewalDecision{
+		Tier:       constants.RenewalTierNone,
+		ExpireDate: expireDate,
+	}
+	expiry := expireDate.UTC().Format(time.RFC3339)
+
+	switch {
+	case IsExpired(now, expireDate, renewalConfig.ForceThreshold):
+		decision.Tier = constants.RenewalTierForce
+		decision.Reason = fmt.Sprintf("certificates expire at %s, within %s, renewing regardless of maintenance windows and change freezes",
+			expiry, renewalConfig.ForceThreshold)
+	case IsExpired(now, expireDate, renewalConfig.MaintenanceWindow):
+		decision.Tier = constants.RenewalTierSchedule
+		decision.Reason = fmt.Sprintf("certificates expire at %s, within %s, renewing in the next maintenance window",
+			expiry, renewalConfig.MaintenanceWindow)
+	case IsExpired(now, expireDate, renewalConfig.WarnThreshold):
+		decision.Tier = constants.RenewalTierWarn
+		decision.Reason = fmt.Sprintf("certificates expire at %s, within %s", expiry, renewalConfig.WarnThreshold)
+	default:
+		decision.Reason = fmt.Sprintf("certificates expire at %s", expiry)
+	}
+
+	return decision
+}
+
+// setRenewalPhase records the phase a renewal entered for the metrics and
+// the health checks. Waiting for workers to be allowed to restart can last
+// days and never counts as stuck.
+func setRenewalPhase(phase string) {
+	metrics.SetRenewalPhase(phase)
+	health.SetPhase(phase, phase == constants.RenewalPhaseWorkerWait)
+}
+
+// runRenewalPhase runs step as phase of a renewal on node, keeps the current
+// phase and the outcome of the phase in the metrics and records a failure as
+// an event.
+func (a *appService) runRenewalPhase(node *v1.Node, phase string, step func() error) error {
+	setRenewalPhase(phase)
+	err := step()
+	metrics.ObserveRenewalPhase(phase, err)
+	if err != nil {
+		a.recordStep(node, v1.EventTypeWarning, phaseFailureReason(phase),
+			"Renewal phase %s failed: %v", phase, err)
+	}
+	return err
+}
+
+// recordRenewalTier keeps the tier and its reason on the current node and
+// emits an event when the tier changes. Every node sees the same expiry, so
+// only the first master records it on the status ConfigMap as well.
+func (a *appService) recordRenewalTier(decision model.RenewalDecision) error {
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	previousTier := currentNode.Annotations[constants.RenewalTierAnnotation]
+	if previousTier == decision.Tier && currentNode.Annotations[constants.RenewalTierReasonAnnotation] == decision.Reason {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				constants.RenewalTierAnnotation:       decision.Tier,
+				constants.RenewalTierReasonAnnotation: decision.Reason,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build renewal tier patch: %v", err)
+	}
+
+	if _, err := a.k8sClient.CoreV1().Nodes().Patch(context.Background(), currentNode.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to record renewal tier: %v", err)
+	}
+
+	if previousTier == decision.Tier {
+		return nil
+	}
+
+	var eventtype, reason string
+	switch decision.Tier {
+	case constants.RenewalTierWarn:
+		eventtype, reason = v1.EventTypeWarning, constants.EventReasonCertificateExpiring
+	case constants.RenewalTierSchedule:
+		eventtype, reason = v1.EventTypeNormal, constants.EventReasonRenewalScheduled
+	case constants.RenewalTierForce:
+		eventtype, reason = v1.EventTypeWarning, constants.EventReasonRenewalForced
+	default:
+		return nil
+	}
+
+	if isFirstMaster, _ := a.isFirstMasterNode(); isFirstMaster {
+		a.recordStep(currentNode, eventtype, reason, "Renewal tier %s: %s", decision.Tier, decision.Reason)
+	} else {
+		a.eventRecorder.Eventf(currentNode, eventtype, reason, "Renewal tier %s: %s", decision.Tier, decision.Reason)
+	}
+
+	return nil
+}
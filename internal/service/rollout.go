@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/internal/model"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// Keys of the status ConfigMap data recording the control-plane rollout the
+// first master started.
+const (
+	statusKeyRolloutExpireDate = "rollout_expire_date"
+	statusKeyRolloutStartedAt  = "rollout_started_at"
+	statusKeyRolloutTier       = "rollout_tier"
+	statusKeyRolloutMasters    = "rollout_masters"
+	statusKeyRolloutRenewed    = "rollout_renewed"
+)
+
+// rolloutRecord is the control-plane rollout recorded on the status
+// ConfigMap. The first master writes it when it starts renewing, every
+// master adds itself to Renewed once its certificates are rotated. The other
+// nodes act on the record rather than on the expiry VKE reports, which
+// changes as soon as the first master is done.
+type rolloutRecord struct {
+	// ExpireDate is the expiry, in RFC 3339, of the certificates renewed.
+	ExpireDate string
+	StartedAt  time.Time
+	Tier       string
+	// Masters are the control-plane nodes in the order they renew.
+	Masters []string
+	Renewed []string
+}
+
+// readRolloutRecord reads the rollout recorded in data and reports whether
+// there is a readable one.
+func readRolloutRecord(data map[string]string) (rolloutRecord, bool) {
+	record := rolloutRecord{
+		ExpireDate: data[statusKeyRolloutExpireDate],
+		Tier:       data[statusKeyRolloutTier],
+		Masters:    splitNames(data[statusKeyRolloutMasters]),
+		Renewed:    splitNames(data[statusKeyRolloutRenewed]),
+	}
+	if record.ExpireDate == "" || len(record.Masters) == 0 {
+		return record, false
+	}
+
+	startedAt, err := time.Parse(time.RFC3339, data[statusKeyRolloutStartedAt])
+	if err != nil {
+		return record, false
+	}
+	record.StartedAt = startedAt
+	return record, true
+}
+
+func (r rolloutRecord) write(data map[string]string) {
+	data[statusKeyRolloutExpireDate] = r.ExpireDate
+	data[statusKeyRolloutStartedAt] = r.StartedAt.UTC().Format(time.RFC3339)
+	data[statusKeyRolloutTier] = r.Tier
+	data[statusKeyRolloutMasters] = strings.Join(r.Masters, ",")
+	data[statusKeyRolloutRenewed] = strings.Join(r.Renewed, ",")
+}
+
+func (r rolloutRecord) renewed(node string) bool {
+	return slices.Contains(r.Renewed, node)
+}
+
+// complete reports whether every master of the rollout is renewed.
+func (r rolloutRecord) complete() bool {
+	for _, master := range r.Masters {
+		if !r.renewed(master) {
+			return false
+		}
+	}
+	return true
+}
+
+// masterDue reports whether master renews now: it is part of the rollout
+// and not renewed yet, every master before it is, and its stagger elapsed.
+func (r rolloutRecord) masterDue(master string, now time.Time, stagger time.Duration) bool {
+	position := slices.Index(r.Masters, master)
+	if position < 0 || r.renewed(master) {
+		return false
+	}
+	for _, previous := range r.Masters[:position] {
+		if !r.renewed(previous) {
+			return false
+		}
+	}
+	return !now.Before(r.StartedAt.Add(time.Duration(position) * stagger))
+}
+
+// workerDue reports whether worker restarts its node agent now: every
+// master is renewed and the worker has not restarted for this rollout yet.
+// Workers that joined after the rollout started use the renewed
+// certificates already.
+func (r rolloutRecord) workerDue(worker *v1.Node) bool {
+	return r.complete() &&
+		worker.Annotations[constants.RenewalRestartedAnnotation] != r.ExpireDate &&
+		worker.CreationTimestamp.Time.Before(r.StartedAt)
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// loadRollout returns the rollout recorded on the status ConfigMap and
+// whether there is one.
+func (a *appService) loadRollout() (rolloutRecord, bool, error) {
+	status, err := a.fetchStatusConfigMap()
+	if err != nil {
+		return rolloutRecord{}, false, err
+	}
+	record, found := readRolloutRecord(status.Data)
+	return record, found, nil
+}
+
+// startRollout records on the status ConfigMap that the first master starts
+// the control-plane rollout for decision across masters. Masters already
+// renewed for the same expiry stay renewed.
+func (a *appService) startRollout(decision model.RenewalDecision, masters []v1.Node) (rolloutRecord, error) {
+	record := rolloutRecord{
+		ExpireDate: decision.ExpireDate.UTC().Format(time.RFC3339),
+		StartedAt:  a.clock.Now(),
+		Tier:       decision.Tier,
+	}
+	for _, master := range masters {
+		record.Masters = append(record.Masters, master.Name)
+	}
+
+	err := a.updateRollout(func(current rolloutRecord, found bool) (rolloutRecord, error) {
+		if found && current.ExpireDate == record.ExpireDate {
+			record.Renewed = current.Renewed
+		}
+		return record, nil
+	})
+	if err != nil {
+		return rolloutRecord{}, fmt.Errorf("failed to record rollout start: %v", err)
+	}
+	return record, nil
+}
+
+// markRolloutRenewed records that node renewed its certificates for the
+// rollout of the certificates expiring at expireDate.
+func (a *appService) markRolloutRenewed(node, expireDate string) error {
+	err := a.updateRollout(func(current rolloutRecord, found bool) (rolloutRecord, error) {
+		if !found || current.ExpireDate != expireDate {
+			return current, fmt.Errorf("rollout for certificates expiring at %s is no longer recorded", expireDate)
+		}
+		if !current.renewed(node) {
+			current.Renewed = append(current.Renewed, node)
+		}
+		return current, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record renewal of %s: %v", node, err)
+	}
+	return nil
+}
+
+// updateRollout rewrites the recorded rollout with change, reading it again
+// when another node updated the status ConfigMap in between.
+func (a *appService) updateRollout(change func(current rolloutRecord, found bool) (rolloutRecord, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		status, err := a.fetchStatusConfigMap()
+		if err != nil {
+			return err
+		}
+
+		current, found := readRolloutRecord(status.Data)
+		record, err := change(current, found)
+		if err != nil {
+			return err
+		}
+
+		status = status.DeepCopy()
+		if status.Data == nil {
+			status.Data = map[string]string{}
+		}
+		record.write(status.Data)
+
+		updated, err := a.k8sClient.CoreV1().ConfigMaps(status.Namespace).Update(context.Background(), status, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) {
+			a.forgetStatusConfigMap()
+		}
+		if err != nil {
+			return err
+		}
+
+		a.status.mu.Lock()
+		a.status.configMap = updated
+		a.status.mu.Unlock()
+		return nil
+	})
+}
+
+// rolloutAttempt remembers when this node last failed its part of a
+// rollout, so a failure is retried every RENEWAL_CHECK_INTERVAL rather than
+// on every poll.
+type rolloutAttempt struct {
+	mu         sync.Mutex
+	expireDate string
+	failedAt   time.Time
+}
+
+func (a *appService) rolloutBackoff(expireDate string) bool {
+	a.attempt.mu.Lock()
+	defer a.attempt.mu.Unlock()
+	return a.attempt.expireDate == expireDate &&
+		a.clock.Now().Sub(a.attempt.failedAt) < config.GlobalConfig.GetRenewalConfig().CheckInterval
+}
+
+func (a *appService) rolloutFailed(expireDate string) {
+	a.attempt.mu.Lock()
+	defer a.attempt.mu.Unlock()
+	a.attempt.expireDate = expireDate
+	a.attempt.failedAt = a.clock.Now()
+}
+
+// FollowRollout acts on the rollout recorded by the first master. A master
+// other than the first one renews its certificates when its turn has come,
+// a worker restarts its node agent once every master is renewed. It runs
+// every RENEWAL_ROLLOUT_POLL_INTERVAL and does not depend on the expiry VKE
+// reports, which the first master updates before the other masters are
+// done.
+func (a *appService) FollowRollout() error {
+	record, found, err := a.loadRollout()
+	if err != nil || !found {
+		return err
+	}
+
+	currentNode, err := getCurrentNode(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to get current node: %v", err)
+	}
+
+	if !a.distribution.IsControlPlane(currentNode) {
+		if !record.workerDue(currentNode) || a.rolloutBackoff(record.ExpireDate) {
+			return nil
+		}
+		if err := a.restartWorkerAgent(currentNode, record); err != nil {
+			a.rolloutFailed(record.ExpireDate)
+			return err
+		}
+		return nil
+	}
+
+	if slices.Index(record.Masters, currentNode.Name) <= 0 {
+		return nil
+	}
+	if !record.masterDue(currentNode.Name, a.clock.Now(), config.GlobalConfig.GetRenewalConfig().MasterStagger) {
+		return nil
+	}
+	if a.rolloutBackoff(record.ExpireDate) {
+		return nil
+	}
+
+	if err := a.renewFollowingMaster(currentNode, record); err != nil {
+		a.rolloutFailed(record.ExpireDate)
+		return err
+	}
+	return nil
+}
+
+// renewFollowingMaster rotates the certificates of a master other than the
+// first one, once the other masters serve behind the load balancer.
+func (a *appService) renewFollowingMaster(currentNode *v1.Node, record rolloutRecord) error {
+	defer setRenewalPhase(constants.RenewalPhaseIdle)
+
+	// The pause may have been set after the first master started.
+	a.waitUntilUnpaused(constants.ActionMasterRenewal, currentNode)
+
+	clID := config.GlobalConfig.GetVKEConfig().ClusterID
+	cluster, err := a.iVKEClusterService.GetCluster(clID, a.getLatestToken(), config.GlobalConfig.GetVKEConfig().VKEURL)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster: %v", err)
+	}
+
+	masters, err := getMasterNodes(a.k8sClient)
+	if err != nil {
+		return fmt.Errorf("failed to list master nodes: %v", err)
+	}
+	var otherMasters []v1.Node
+	for _, master := range masters {
+		if master.Name != currentNode.Name {
+			otherMasters = append(otherMasters, master)
+		}
+	}
+
+	klog.V(0).InfoS("Renewing certificates following the first master",
+		"cluster_id", clID,
+		"node", currentNode.Name,
+		"position", slices.Index(record.Masters, currentNode.Name)+1,
+		"expire_date", record.ExpireDate,
+		"component", "certificate_renewal")
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonRenewalStarted,
+		"Control-plane certificate renewal started, position %d of %d, tier %s",
+		slices.Index(record.Masters, currentNode.Name)+1, len(record.Masters), record.Tier)
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseLoadbalancerHealth, func() error {
+		if err := a.checkLoadbalancerHealthMonitors(cluster); err != nil {
+			return err
+		}
+		return a.waitForHealthyLoadbalancerMembers(cluster, otherMasters)
+	}); err != nil {
+		return err
+	}
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseBackup, func() error {
+		return a.backupBeforeRenewal(currentNode.Name)
+	}); err != nil {
+		return err
+	}
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseRotate, a.distribution.RotateCertificates); err != nil {
+		return err
+	}
+	a.recordStep(currentNode, v1.EventTypeNormal, constants.EventReasonServiceRestarted,
+		"Restarted %s to rotate the control-plane certificates", a.distribution.ServerUnit())
+
+	if err := a.runRenewalPhase(currentNode, constants.RenewalPhaseLoadbalancerHealth, func() error {
+		return a.waitForHealthyLoadbalancerMembers(cluster, []v1.Node{*currentNode})
+	}); err != nil {
+		return err
+	}
+
+	return a.markRolloutRenewed(currentNode.Name, record.ExpireDate)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/config"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) DecisionTime() time.Time { return c.now }
+func (c *testClock) Simulated() bool         { return false }
+
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"VKE_CLUSTER_ID":                    "8f4f4a9e-3c3e-4b8e-9d47-6f0c3a1e2b5d",
+		"VKE_PROJECT_ID":                    "project",
+		"VKE_IDENTITY_URL":                  "https://identity.example.com/v3",
+		"VKE_URL":                           "https://vke.example.com",
+		"VKE_APPLICATION_CREDENTIAL_ID":     "credential",
+		"VKE_APPLICATION_CREDENTIAL_SECRET": "secret",
+		"APPROVAL_CONFIG_MAP_NAME":          "vke-cluster-agent-renewal-approval",
+		"EVENTS_STATUS_CONFIG_MAP_NAME":     "vke-cluster-agent-status",
+		"KUBECONFIG_ADMIN_USER":             "vke-admin",
+	} {
+		t.Setenv(key, value)
+	}
+	if _, err := config.NewConfigureManager(""); err != nil {
+		t.Fatalf("failed to load configuration: %v", err)
+	}
+}
+
+func testMasters(names ...string) []v1.Node {
+	var nodes []v1.Node
+	for _, name := range names {
+		nodes = append(nodes, v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return nodes
+}
+
+// The first master updates the expiry in VKE right after renewing itself, so
+// from then on the other masters and the workers only act because of the
+// rollout record. Workers wait for every master.
+func TestRolloutFollowersActOnRecordAfterVKEUpdate(t *testing.T) {
+	loadTestConfig(t)
+	renewalConfig := config.GlobalConfig.GetRenewalConfig()
+	stagger := renewalConfig.MasterStagger
+
+	clock := &testClock{now: time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)}
+	a := &appService{k8sClient: fake.NewSimpleClientset(), clock: clock}
+
+	decision := decideRenewal(clock.now, clock.now.Add(5*24*time.Hour), renewalConfig)
+	if decision.Tier != constants.RenewalTierSchedule {
+		t.Fatalf("decision tier = %s, want %s", decision.Tier, constants.RenewalTierSchedule)
+	}
+
+	if _, err := a.startRollout(decision, testMasters("master-1", "master-2", "master-3")); err != nil {
+		t.Fatal(err)
+	}
+	record := loadTestRollout(t, a)
+	if record.masterDue("master-2", clock.now.Add(time.Hour), stagger) {
+		t.Error("master-2 is due before master-1 renewed")
+	}
+
+	if err := a.markRolloutRenewed("master-1", record.ExpireDate); err != nil {
+		t.Fatal(err)
+	}
+
+	// VKE now reports the renewed expiry, which needs no renewal.
+	if tier := decideRenewal(clock.now, clock.now.Add(renewalConfig.CertificateLifetime), renewalConfig).Tier; tier != constants.RenewalTierNone {
+		t.Fatalf("decision tier after the VKE update = %s, want %s", tier, constants.RenewalTierNone)
+	}
+
+	worker := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:              "worker-1",
+		CreationTimestamp: metav1.NewTime(clock.now.Add(-24 * time.Hour)),
+	}}
+
+	record = loadTestRollout(t, a)
+	if record.workerDue(worker) {
+		t.Error("worker is due before every master renewed")
+	}
+	if record.masterDue("master-2", clock.now, stagger) {
+		t.Error("master-2 is due before its stagger elapsed")
+	}
+	clock.now = clock.now.Add(stagger)
+	if !record.masterDue("master-2", clock.now, stagger) {
+		t.Error("master-2 is not due after master-1 renewed and its stagger elapsed")
+	}
+	if record.masterDue("master-3", clock.now.Add(stagger), stagger) {
+		t.Error("master-3 is due before master-2 renewed")
+	}
+
+	// The first master retries a failed VKE update for the same expiry.
+	if _, err := a.startRollout(decision, testMasters("master-1", "master-2", "master-3")); err != nil {
+		t.Fatal(err)
+	}
+	if record = loadTestRollout(t, a); !record.renewed("master-1") {
+		t.Error("restarting the rollout for the same expiry forgot that master-1 renewed")
+	}
+
+	if err := a.markRolloutRenewed("master-2", record.ExpireDate); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(2 * stagger)
+	record = loadTestRollout(t, a)
+	if !record.masterDue("master-3", clock.now, stagger) {
+		t.Error("master-3 is not due after master-2 renewed")
+	}
+	if record.complete() {
+		t.Error("rollout complete before master-3 renewed")
+	}
+
+	if err := a.markRolloutRenewed("master-3", record.ExpireDate); err != nil {
+		t.Fatal(err)
+	}
+	if record = loadTestRollout(t, a); !record.complete() {
+		t.Errorf("rollout not complete after every master renewed: %+v", record)
+	}
+
+	if !record.workerDue(worker) {
+		t.Error("worker is not due after every master renewed")
+	}
+	worker.Annotations = map[string]string{constants.RenewalRestartedAnnotation: record.ExpireDate}
+	if record.workerDue(worker) {
+		t.Error("worker is due again after it restarted for this rollout")
+	}
+
+	joined := &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:              "worker-2",
+		CreationTimestamp: metav1.NewTime(clock.now),
+	}}
+	if record.workerDue(joined) {
+		t.Error("worker that joined after the rollout started is due")
+	}
+}
+
+func TestRolloutMarkRenewedRejectsOtherExpiry(t *testing.T) {
+	loadTestConfig(t)
+	clock := &testClock{now: time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)}
+	a := &appService{k8sClient: fake.NewSimpleClientset(), clock: clock}
+
+	decision := decideRenewal(clock.now, clock.now.Add(24*time.Hour), config.GlobalConfig.GetRenewalConfig())
+	if _, err := a.startRollout(decision, testMasters("master-1", "master-2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.markRolloutRenewed("master-2", "2020-01-01T00:00:00Z"); err == nil {
+		t.Error("marking a master renewed for another rollout succeeded")
+	}
+}
+
+func TestReadRolloutRecord(t *testing.T) {
+	if _, found := readRolloutRecord(map[string]string{statusKeyClusterID: "cluster"}); found {
+		t.Error("found a rollout in a status ConfigMap without one")
+	}
+
+	_, found := readRolloutRecord(map[string]string{
+		statusKeyRolloutExpireDate: "2026-10-20T00:00:00Z",
+		statusKeyRolloutStartedAt:  "yesterday",
+		statusKeyRolloutMasters:    "master-1",
+	})
+	if found {
+		t.Error("found a rollout with an unreadable start")
+	}
+}
+
+func loadTestRollout(t *testing.T, a *appService) rolloutRecord {
+	t.Helper()
+	record, found, err := a.loadRollout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("no rollout recorded")
+	}
+	return record
+}
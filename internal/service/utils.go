@@ -42,8 +42,8 @@ func DeleteItemFromArray(a []string, item string) []string {
 	return a
 }
 
-func IsExpired(currentDate time.Time, date time.Time, maintenanceWindow time.Duration) bool {
-	return currentDate.Add(maintenanceWindow).After(date)
+func IsExpired(currentDate time.Time, date time.Time, threshold time.Duration) bool {
+	return currentDate.Add(threshold).After(date)
 }
 
 func GetKubernetesVersion(client *kubernetes.Clientset) string {
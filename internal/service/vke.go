@@ -9,6 +9,8 @@ import (
 
 	"github.com/vmindtech/vke-cluster-agent/internal/dto/request"
 	"github.com/vmindtech/vke-cluster-agent/internal/dto/resource"
+	"github.com/vmindtech/vke-cluster-agent/pkg/health"
+	"github.com/vmindtech/vke-cluster-agent/pkg/metrics"
 	"k8s.io/klog"
 )
 
@@ -18,7 +20,8 @@ const (
 
 type IVKEService interface {
 	GetCluster(clusterID string, token string, vkeURL string) (*resource.VKEClusterResponse, error)
-	UpdateKubeconfig(clusterID string, token string, vkeURL string, kubeconfig string) error
+	GetKubeconfig(clusterID string, token string, vkeURL string) (*resource.VKEKubeconfigResponse, error)
+	UpdateKubeconfig(clusterID string, token string, vkeURL string, kubeconfig request.UpdateKubeconfigRequest) error
 	UpdateCluster(clusterID string, token string, vkeURL string, cluster request.UpdateClusterRequest) error
 }
 
@@ -43,7 +46,7 @@ func (v *vkeService) GetCluster(clusterID string, token string, vkeURL string) (
 			InsecureSkipVerify: true,
 		},
 	}
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: metrics.InstrumentVKE("get_cluster", tr)}
 	resp, err := client.Do(r)
 	if err != nil {
 		klog.Errorf("Failed to send request - cluster_id: %s", clusterID)
@@ -56,6 +59,7 @@ func (v *vkeService) GetCluster(clusterID string, token string, vkeURL string) (
 			clusterID, resp.StatusCode)
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	health.RecordSuccess(health.DependencyVKE)
 
 	var respDecoder resource.VKEClusterResponse
 	if err = json.NewDecoder(resp.Body).Decode(&respDecoder); err != nil {
@@ -69,16 +73,57 @@ func (v *vkeService) GetCluster(clusterID string, token string, vkeURL string) (
 	return &respDecoder, nil
 }
 
-func (v *vkeService) UpdateKubeconfig(clusterID string, token string, vkeURL string, kubeconfig string) error {
-	url := fmt.Sprintf("%s/kubeconfig/%s", vkeURL, clusterID)
+// GetKubeconfig returns the kubeconfig VKE holds for the cluster, or nil when
+// VKE has none yet.
+func (v *vkeService) GetKubeconfig(clusterID string, token string, vkeURL string) (*resource.VKEKubeconfigResponse, error) {
+	r, err := http.NewRequest("GET", fmt.Sprintf("%s/kubeconfig/%s", vkeURL, clusterID), nil)
+	if err != nil {
+		klog.Errorf("Failed to create request - cluster_id: %s", clusterID)
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Auth-Token", token)
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}
+	client := &http.Client{Transport: metrics.InstrumentVKE("get_kubeconfig", tr)}
+	resp, err := client.Do(r)
+	if err != nil {
+		klog.Errorf("Failed to send request - cluster_id: %s", clusterID)
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		health.RecordSuccess(health.DependencyVKE)
+		klog.V(2).Infof("No kubeconfig stored in VKE - cluster_id: %s", clusterID)
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		klog.Errorf("Unexpected status code received - cluster_id: %s, status_code: %d",
+			clusterID, resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	health.RecordSuccess(health.DependencyVKE)
 
-	payload := struct {
-		Kubeconfig string `json:"kubeconfig"`
-	}{
-		Kubeconfig: kubeconfig,
+	var respDecoder resource.VKEKubeconfigResponse
+	if err = json.NewDecoder(resp.Body).Decode(&respDecoder); err != nil {
+		klog.Errorf("Failed to decode response - cluster_id: %s", clusterID)
+		return nil, fmt.Errorf("error decoding response: %v", err)
 	}
 
-	jsonData, err := json.Marshal(payload)
+	return &respDecoder, nil
+}
+
+func (v *vkeService) UpdateKubeconfig(clusterID string, token string, vkeURL string, kubeconfig request.UpdateKubeconfigRequest) error {
+	url := fmt.Sprintf("%s/kubeconfig/%s", vkeURL, clusterID)
+
+	jsonData, err := json.Marshal(kubeconfig)
 	if err != nil {
 		return fmt.Errorf("error marshaling kubeconfig: %v", err)
 	}
@@ -96,7 +141,7 @@ func (v *vkeService) UpdateKubeconfig(clusterID string, token string, vkeURL str
 			InsecureSkipVerify: true,
 		},
 	}
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: metrics.InstrumentVKE("update_kubeconfig", tr)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request: %v", err)
@@ -106,6 +151,7 @@ func (v *vkeService) UpdateKubeconfig(clusterID string, token string, vkeURL str
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	health.RecordSuccess(health.DependencyVKE)
 
 	return nil
 }
@@ -131,7 +177,7 @@ func (v *vkeService) UpdateCluster(clusterID string, token string, vkeURL string
 			InsecureSkipVerify: true,
 		},
 	}
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: metrics.InstrumentVKE("update_cluster", tr)}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request: %v", err)
@@ -141,6 +187,7 @@ func (v *vkeService) UpdateCluster(clusterID string, token string, vkeURL string
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	health.RecordSuccess(health.DependencyVKE)
 
 	return nil
 }
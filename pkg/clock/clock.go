@@ -0,0 +1,60 @@
+package clock
+
+import "time"
+
+// Clock tells the agent what time it is. Now is the wall clock and is used
+// for everything that is recorded or sent to VKE. DecisionTime is the time
+// expiry decisions are taken at, which only differs from Now while a
+// simulation is configured.
+type Clock interface {
+	Now() time.Time
+	DecisionTime() time.Time
+	Simulated() bool
+}
+
+type realClock struct{}
+
+// NewRealClock returns a Clock that takes decisions at the wall-clock time.
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) DecisionTime() time.Time {
+	return time.Now()
+}
+
+func (realClock) Simulated() bool {
+	return false
+}
+
+type simulatedClock struct {
+	offset time.Duration
+}
+
+// NewOffsetClock returns a Clock whose decisions are taken offset away from
+// the wall clock.
+func NewOffsetClock(offset time.Duration) Clock {
+	return simulatedClock{offset: offset}
+}
+
+// NewSimulatedClock returns a Clock whose decision time starts at start and
+// advances with the wall clock from then on.
+func NewSimulatedClock(start time.Time) Clock {
+	return simulatedClock{offset: time.Until(start)}
+}
+
+func (c simulatedClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c simulatedClock) DecisionTime() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+func (c simulatedClock) Simulated() bool {
+	return true
+}
@@ -8,21 +8,31 @@ const (
 	EnglishLanguage = "en"
 )
 
-// Maintenance Window
+// RKE2 Related Constants
 const (
-	OneHourMaintenanceWindow = 1 * time.Hour
-	OneWeekMaintenanceWindow = 7 * 24 * time.Hour
-	TwoWeekMaintenanceWindow = 14 * 24 * time.Hour
+	RKE2RestartWaitDuration = 30 * time.Second
+	RKE2KubeconfigPath      = "/etc/rancher/rke2/rke2.yaml"
+	RKE2ServerTLSDir        = "/var/lib/rancher/rke2/server/tls"
 )
 
-// VKE Check Certificate Expiration Interval
+// K3s Related Constants
 const (
-	VKECheckCertificateExpirationInterval = 1 * time.Hour
+	K3sKubeconfigPath = "/etc/rancher/k3s/k3s.yaml"
+	K3sServerTLSDir   = "/var/lib/rancher/k3s/server/tls"
 )
 
-// RKE2 Related Constants
+// Kubeadm Related Constants
 const (
-	RKE2RestartWaitDuration = 30 * time.Second
+	KubeadmKubeconfigPath = "/etc/kubernetes/admin.conf"
+	KubeadmPKIDir         = "/etc/kubernetes/pki"
+)
+
+// Distributions
+const (
+	DistributionAuto    = "auto"
+	DistributionRKE2    = "rke2"
+	DistributionK3s     = "k3s"
+	DistributionKubeadm = "kubeadm"
 )
 
 // Node Label Selectors
@@ -31,9 +41,97 @@ const (
 	WorkerNodeLabelSelector = "!node-role.kubernetes.io/master,!node-role.kubernetes.io/control-plane"
 )
 
-// New constants
+// Control Plane Ports
+const (
+	KubeAPIServerPort  = 6443
+	RKE2SupervisorPort = 9345
+)
+
+// Octavia Statuses
 const (
-	CertificateCheckInterval = 1 * time.Hour
+	LoadbalancerProvisioningStatusActive = "ACTIVE"
+	LoadbalancerProvisioningStatusError  = "ERROR"
+	MemberOperatingStatusOnline          = "ONLINE"
+	MemberOperatingStatusNoMonitor       = "NO_MONITOR"
+)
+
+// Disruptive Actions
+const (
+	ActionMasterRenewal = "master_renewal"
+	ActionWorkerRestart = "worker_restart"
+	ActionRemediation   = "remediation"
+	// Only gated by the pause.
+	ActionLoadbalancerReconcile = "loadbalancer_reconcile"
+	ActionKubeconfigUpload      = "kubeconfig_upload"
+)
+
+// Renewal Tiers, from the furthest to the closest expiry
+const (
+	RenewalTierNone     = "none"
+	RenewalTierWarn     = "warn"
+	RenewalTierSchedule = "schedule"
+	RenewalTierForce    = "force"
+)
+
+// Node Annotations
+const (
+	RemediationLastActionAnnotation     = "vke.vmindtech.com/remediation-last-action"
+	RemediationLastActionTimeAnnotation = "vke.vmindtech.com/remediation-last-action-time"
+	RemediationHistoryAnnotation        = "vke.vmindtech.com/remediation-history"
+	RemediationNotReadySinceAnnotation  = "vke.vmindtech.com/remediation-not-ready-since"
+
+	KubeconfigUploadedAtAnnotation      = "vke.vmindtech.com/kubeconfig-uploaded-at"
+	KubeconfigCAFingerprintAnnotation   = "vke.vmindtech.com/kubeconfig-ca-sha256"
+	KubeconfigCertFingerprintAnnotation = "vke.vmindtech.com/kubeconfig-client-certificate-sha256"
 
-	RenewalProcessTimeout = 30 * time.Minute
+	RenewalTierAnnotation       = "vke.vmindtech.com/renewal-tier"
+	RenewalTierReasonAnnotation = "vke.vmindtech.com/renewal-tier-reason"
+	// RenewalRestartedAnnotation holds the expiry of the certificates whose
+	// renewal a worker restarted its node agent for.
+	RenewalRestartedAnnotation = "vke.vmindtech.com/renewal-restarted-for"
+)
+
+// Renewal Phases
+const (
+	RenewalPhaseIdle               = "idle"
+	RenewalPhaseBackup             = "backup"
+	RenewalPhaseRotate             = "rotate_certificates"
+	RenewalPhaseLoadbalancerHealth = "loadbalancer_health"
+	RenewalPhaseKubeconfigUpload   = "kubeconfig_upload"
+	RenewalPhaseVKEUpdate          = "vke_update"
+	RenewalPhaseWorkerWait         = "worker_wait"
+	RenewalPhaseWorkerRestart      = "worker_restart"
+)
+
+// Pause
+const (
+	PausedAnnotation     = "vke.vmindtech.com/paused"
+	PauseRecheckInterval = time.Minute
+)
+
+// Renewal Approval
+const (
+	RenewalApprovedByAnnotation = "vke.vmindtech.com/renewal-approved-by"
+	RenewalApprovalHistoryLimit = 20
+
+	RenewalApprovalPending   = "pending"
+	RenewalApprovalApproved  = "approved"
+	RenewalApprovalEscalated = "escalated"
+)
+
+// Node Labels
+const (
+	TopologyZoneLabel = "topology.kubernetes.io/zone"
+	InstanceTypeLabel = "node.kubernetes.io/instance-type"
+	VKENodeGroupLabel = "vke.vmindtech.com/node-group"
+)
+
+// OpenStack Provider ID
+const (
+	OpenstackProviderIDPrefix = "openstack://"
+)
+
+// Kubeconfig Encryption
+const (
+	KubeconfigEncryptionAlgorithm = "RSA-OAEP-256+A256GCM"
 )
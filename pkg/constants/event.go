@@ -0,0 +1,37 @@
+package constants
+
+// Event Reasons
+const (
+	EventReasonNodeSoftRebooted       = "NodeSoftRebooted"
+	EventReasonNodeHardRebooted       = "NodeHardRebooted"
+	EventReasonNodeRebootFailed       = "NodeRebootFailed"
+	EventReasonNodeRemediationLimited = "NodeRemediationLimited"
+	EventReasonNodeRemediationSkipped = "NodeRemediationSkipped"
+	EventReasonNodeIdentityUpdated    = "NodeIdentityUpdated"
+	EventReasonNodeFlavorMismatch     = "NodeFlavorMismatch"
+	EventReasonKubeconfigDrift        = "KubeconfigDrift"
+	EventReasonKubeconfigUploaded     = "KubeconfigUploaded"
+	EventReasonAdminCertificateIssued = "AdminCertificateIssued"
+	EventReasonConfigReloaded         = "ConfigReloaded"
+	EventReasonConfigReloadRejected   = "ConfigReloadRejected"
+	EventReasonOutsideMaintenance     = "OutsideMaintenanceWindow"
+	EventReasonChangeFreeze           = "ChangeFreeze"
+	EventReasonChangeFreezeOverridden = "ChangeFreezeOverridden"
+	EventReasonCertificateExpiring    = "CertificateExpiring"
+	EventReasonRenewalScheduled       = "RenewalScheduled"
+	EventReasonRenewalForced          = "RenewalForced"
+	EventReasonRenewalApprovalNeeded  = "RenewalApprovalRequested"
+	EventReasonRenewalApproved        = "RenewalApproved"
+	EventReasonRenewalEscalated       = "RenewalApprovalEscalated"
+	EventReasonDisruptionPaused       = "DisruptionPaused"
+	EventReasonRenewalStarted         = "RenewalStarted"
+	EventReasonServiceRestarted       = "ServiceRestarted"
+	EventReasonServiceRestartFailed   = "ServiceRestartFailed"
+	EventReasonVKEClusterUpdated      = "VKEClusterUpdated"
+	EventReasonRenewalVerifyFailed    = "RenewalVerificationFailed"
+	EventReasonRenewalPhaseFailed     = "RenewalPhaseFailed"
+)
+
+const (
+	EventSourceComponent = "vke-cluster-agent"
+)
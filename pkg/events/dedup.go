@@ -0,0 +1,88 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// dedupRecorder drops an event when the same object already got one with
+// the same type, reason and message within the interval. The agent repeats
+// its checks, and the steps it skips, every few minutes; the recorder's own
+// aggregation would still send an update for every repetition.
+type dedupRecorder struct {
+	recorder record.EventRecorder
+	interval func() time.Duration
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+// NewDeduplicatingRecorder wraps recorder. The interval is read on every
+// event so configuration changes apply.
+func NewDeduplicatingRecorder(recorder record.EventRecorder, interval func() time.Duration) record.EventRecorder {
+	return &dedupRecorder{
+		recorder: recorder,
+		interval: interval,
+		sent:     map[string]time.Time{},
+	}
+}
+
+func (d *dedupRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if d.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	d.recorder.Event(object, eventtype, reason, message)
+}
+
+func (d *dedupRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	d.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (d *dedupRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if d.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	d.recorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+}
+
+// duplicate reports whether the event was sent within the interval and
+// otherwise remembers it. Entries older than the interval are forgotten.
+func (d *dedupRecorder) duplicate(object runtime.Object, eventtype, reason, message string) bool {
+	key := objectKey(object) + "\x00" + eventtype + "\x00" + reason + "\x00" + message
+	now := time.Now()
+	interval := d.interval()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, sentAt := range d.sent {
+		if now.Sub(sentAt) >= interval {
+			delete(d.sent, k)
+		}
+	}
+
+	if _, ok := d.sent[key]; ok {
+		return true
+	}
+	d.sent[key] = now
+	return false
+}
+
+// objectKey identifies object by its UID, or by its type, namespace and
+// name when it has none.
+func objectKey(object runtime.Object) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T", object)
+	}
+	if uid := accessor.GetUID(); uid != "" {
+		return string(uid)
+	}
+	return fmt.Sprintf("%T/%s/%s", object, accessor.GetNamespace(), accessor.GetName())
+}
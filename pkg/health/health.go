@@ -0,0 +1,138 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+)
+
+// Dependencies whose last successful call is tracked.
+const (
+	DependencyVKE      = "vke"
+	DependencyKeystone = "keystone"
+)
+
+// Limits are the ages after which the tracked state is considered unhealthy.
+type Limits struct {
+	// Heartbeat is how old the last check loop heartbeat may get before the
+	// agent is not live.
+	Heartbeat time.Duration
+	// Phase is how long a renewal phase may run before it counts as stuck
+	// and the agent is not live.
+	Phase time.Duration
+	// Dependency is how old the last successful call of a dependency may get
+	// before the agent is not ready.
+	Dependency time.Duration
+}
+
+var state = struct {
+	mu          sync.Mutex
+	started     time.Time
+	heartbeat   time.Time
+	lastSuccess map[string]time.Time
+	phase       string
+	phaseSince  time.Time
+	unbounded   bool
+}{
+	started:     time.Now(),
+	lastSuccess: map[string]time.Time{},
+	phase:       constants.RenewalPhaseIdle,
+}
+
+// Heartbeat records that the check loop, or a wait that blocks it, is still
+// making progress.
+func Heartbeat() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.heartbeat = time.Now()
+}
+
+// RecordSuccess records a successful call of dependency.
+func RecordSuccess(dependency string) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.lastSuccess[dependency] = time.Now()
+}
+
+// SetPhase records the renewal phase the agent entered. An unbounded phase,
+// such as waiting for a maintenance window, never counts as stuck. Entering
+// a phase counts as a heartbeat, so returning to idle after a long renewal
+// does not look like a wedged loop.
+func SetPhase(phase string, unbounded bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	now := time.Now()
+	if phase != state.phase {
+		state.phase = phase
+		state.phaseSince = now
+	}
+	state.unbounded = unbounded
+	state.heartbeat = now
+}
+
+// Live returns the reasons the agent is wedged and should be restarted, none
+// when it is live. While a bounded renewal phase runs the check loop is
+// blocked on purpose, so only the phase limit applies. An agent that has not
+// sent a heartbeat yet gets the heartbeat limit from its start.
+func Live(limits Limits) []string {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	now := time.Now()
+	if state.phase != constants.RenewalPhaseIdle && !state.unbounded {
+		if age := now.Sub(state.phaseSince); age > limits.Phase {
+			return []string{fmt.Sprintf("renewal phase %s running for %s", state.phase, age.Round(time.Second))}
+		}
+		return nil
+	}
+
+	heartbeat := state.heartbeat
+	if heartbeat.IsZero() {
+		heartbeat = state.started
+	}
+	if age := now.Sub(heartbeat); age > limits.Heartbeat {
+		return []string{fmt.Sprintf("no check loop heartbeat for %s", age.Round(time.Second))}
+	}
+	return nil
+}
+
+// Ready returns the reasons the agent cannot do its work, none when every
+// dependency answered recently.
+func Ready(limits Limits) []string {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	var problems []string
+	now := time.Now()
+	for _, dependency := range []string{DependencyKeystone, DependencyVKE} {
+		last, ok := state.lastSuccess[dependency]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("no successful %s call yet", dependency))
+		case now.Sub(last) > limits.Dependency:
+			problems = append(problems, fmt.Sprintf("last successful %s call %s ago", dependency, now.Sub(last).Round(time.Second)))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// Handler answers 200 when check returns no problems and 503 with the
+// problems otherwise.
+func Handler(check func() []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if problems := check(); len(problems) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(problems, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
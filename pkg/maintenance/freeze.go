@@ -0,0 +1,97 @@
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Freeze is a change freeze during which the agent must not disrupt the
+// cluster, such as a campaign or the year-end.
+type Freeze struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// ParseFreeze reads a freeze written as "[<name>=]<start>/<end>". Start and
+// end are RFC 3339 timestamps or dates in location. A date as the end
+// includes the whole day.
+func ParseFreeze(spec string, location *time.Location) (Freeze, error) {
+	var f Freeze
+
+	period := strings.TrimSpace(spec)
+	if name, rest, named := strings.Cut(period, "="); named {
+		f.Name, period = strings.TrimSpace(name), strings.TrimSpace(rest)
+	}
+
+	from, to, found := strings.Cut(period, "/")
+	if !found {
+		return f, fmt.Errorf("freeze %q is not in the form \"[<name>=]<start>/<end>\"", spec)
+	}
+
+	var err error
+	if f.Start, _, err = parseFreezeTime(strings.TrimSpace(from), location); err != nil {
+		return f, fmt.Errorf("freeze %q: %v", spec, err)
+	}
+
+	var isDate bool
+	if f.End, isDate, err = parseFreezeTime(strings.TrimSpace(to), location); err != nil {
+		return f, fmt.Errorf("freeze %q: %v", spec, err)
+	}
+	if isDate {
+		f.End = f.End.AddDate(0, 0, 1)
+	}
+
+	if !f.End.After(f.Start) {
+		return f, fmt.Errorf("freeze %q ends before it starts", spec)
+	}
+	if f.Name == "" {
+		f.Name = period
+	}
+
+	return f, nil
+}
+
+// ParseFreezeList reads freezes separated by semicolons. An empty spec yields
+// no freezes.
+func ParseFreezeList(spec string, location *time.Location) ([]Freeze, error) {
+	var freezes []Freeze
+	for _, item := range strings.Split(spec, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		f, err := ParseFreeze(item, location)
+		if err != nil {
+			return nil, err
+		}
+		freezes = append(freezes, f)
+	}
+	return freezes, nil
+}
+
+func parseFreezeTime(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time %q, expected an RFC 3339 timestamp or a date", value)
+}
+
+func (f Freeze) String() string {
+	return fmt.Sprintf("%s (%s - %s)", f.Name, f.Start.Format(time.RFC3339), f.End.Format(time.RFC3339))
+}
+
+// ActiveFreeze returns the freeze that contains t. When several overlap, the
+// one ending last wins.
+func ActiveFreeze(freezes []Freeze, t time.Time) (Freeze, bool) {
+	var active Freeze
+	for _, f := range freezes {
+		if !t.Before(f.Start) && t.Before(f.End) && f.End.After(active.End) {
+			active = f
+		}
+	}
+	return active, !active.End.IsZero()
+}
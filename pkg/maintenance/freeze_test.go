@@ -0,0 +1,81 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFreeze(t *testing.T) {
+	location := time.FixedZone("UTC+3", 3*60*60)
+	tests := []struct {
+		spec      string
+		wantName  string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			spec:      "2026-12-24/2026-12-26",
+			wantName:  "2026-12-24/2026-12-26",
+			wantStart: time.Date(2026, 12, 24, 0, 0, 0, 0, location),
+			wantEnd:   time.Date(2026, 12, 27, 0, 0, 0, 0, location),
+		},
+		{
+			spec:      " year-end = 2026-12-31 / 2027-01-01 ",
+			wantName:  "year-end",
+			wantStart: time.Date(2026, 12, 31, 0, 0, 0, 0, location),
+			wantEnd:   time.Date(2027, 1, 2, 0, 0, 0, 0, location),
+		},
+		{
+			spec:      "campaign=2026-11-27T18:00:00Z/2026-11-30T06:00:00Z",
+			wantName:  "campaign",
+			wantStart: time.Date(2026, 11, 27, 18, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 11, 30, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			spec:      "launch=2026-11-27/2026-11-27T12:00:00+03:00",
+			wantName:  "launch",
+			wantStart: time.Date(2026, 11, 27, 0, 0, 0, 0, location),
+			wantEnd:   time.Date(2026, 11, 27, 12, 0, 0, 0, location),
+		},
+	}
+	for _, tt := range tests {
+		f, err := ParseFreeze(tt.spec, location)
+		if err != nil {
+			t.Errorf("ParseFreeze(%q): %v", tt.spec, err)
+			continue
+		}
+		if f.Name != tt.wantName || !f.Start.Equal(tt.wantStart) || !f.End.Equal(tt.wantEnd) {
+			t.Errorf("ParseFreeze(%q) = %q %s - %s, want %q %s - %s", tt.spec,
+				f.Name, f.Start, f.End, tt.wantName, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestParseFreezeInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"2026-12-24",
+		"year-end=2026-12-24",
+		"2026-12-24/tomorrow",
+		"2026-12-26/2026-12-24",
+		"2026-12-24T12:00:00Z/2026-12-24T12:00:00Z",
+	} {
+		if _, err := ParseFreeze(spec, time.UTC); err == nil {
+			t.Errorf("ParseFreeze(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestActiveFreeze(t *testing.T) {
+	freezes, err := ParseFreezeList("a=2026-12-20/2026-12-24; b=2026-12-22/2026-12-31", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f, ok := ActiveFreeze(freezes, time.Date(2026, 12, 23, 0, 0, 0, 0, time.UTC)); !ok || f.Name != "b" {
+		t.Errorf("ActiveFreeze() = %q, %v, want the one ending last", f.Name, ok)
+	}
+	if _, ok := ActiveFreeze(freezes, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)); ok {
+		t.Error("ActiveFreeze() after every freeze found one")
+	}
+}
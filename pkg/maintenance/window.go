@@ -0,0 +1,171 @@
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a weekly recurring time range such as "Sat 02:00-06:00" or
+// "Mon-Fri 22:00-04:00". A window whose end is not after its start ends on
+// the next day. Times are interpreted in the location of the time passed to
+// its methods.
+type Window struct {
+	days                [7]bool
+	startHour, startMin int
+	endHour, endMin     int
+	spec                string
+}
+
+// Parse reads a window written as "<days> <HH:MM>-<HH:MM>". Days are a
+// weekday, a range of weekdays (Mon-Fri) or * for every day. Cron
+// expressions are rejected: they name start times but not how long a window
+// stays open.
+func Parse(spec string) (Window, error) {
+	w := Window{spec: strings.TrimSpace(spec)}
+
+	fields := strings.Fields(w.spec)
+	if len(fields) >= 5 || strings.HasPrefix(w.spec, "@") {
+		return w, fmt.Errorf("window %q looks like a cron expression, which is not supported, use \"<days> <HH:MM>-<HH:MM>\"", spec)
+	}
+	if len(fields) != 2 {
+		return w, fmt.Errorf("window %q is not in the form \"<days> <HH:MM>-<HH:MM>\"", spec)
+	}
+
+	if err := w.parseDays(strings.ToLower(fields[0])); err != nil {
+		return w, fmt.Errorf("window %q: %v", spec, err)
+	}
+
+	from, to, found := strings.Cut(fields[1], "-")
+	if !found {
+		return w, fmt.Errorf("window %q has no time range", spec)
+	}
+
+	var err error
+	if w.startHour, w.startMin, err = parseClock(from); err != nil {
+		return w, fmt.Errorf("window %q: %v", spec, err)
+	}
+	if w.endHour, w.endMin, err = parseClock(to); err != nil {
+		return w, fmt.Errorf("window %q: %v", spec, err)
+	}
+
+	return w, nil
+}
+
+// ParseList reads windows separated by semicolons. An empty spec yields no
+// windows.
+func ParseList(spec string) ([]Window, error) {
+	var windows []Window
+	for _, item := range strings.Split(spec, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		w, err := Parse(item)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+func (w *Window) parseDays(days string) error {
+	if days == "*" {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return nil
+	}
+
+	from, to, isRange := strings.Cut(days, "-")
+	first, ok := weekdays[from]
+	if !ok {
+		return fmt.Errorf("unknown weekday %q", from)
+	}
+	if !isRange {
+		w.days[first] = true
+		return nil
+	}
+
+	last, ok := weekdays[to]
+	if !ok {
+		return fmt.Errorf("unknown weekday %q", to)
+	}
+	for d := first; ; d = (d + 1) % 7 {
+		w.days[d] = true
+		if d == last {
+			return nil
+		}
+	}
+}
+
+func parseClock(value string) (int, int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func (w Window) String() string {
+	return w.spec
+}
+
+// occurrence returns the start and end of the window opening on day,
+// and whether it opens on that weekday at all.
+func (w Window) occurrence(day time.Time) (time.Time, time.Time, bool) {
+	if !w.days[day.Weekday()] {
+		return time.Time{}, time.Time{}, false
+	}
+
+	y, m, d := day.Date()
+	start := time.Date(y, m, d, w.startHour, w.startMin, 0, 0, day.Location())
+	end := time.Date(y, m, d, w.endHour, w.endMin, 0, 0, day.Location())
+	if !end.After(start) {
+		end = time.Date(y, m, d+1, w.endHour, w.endMin, 0, 0, day.Location())
+	}
+	return start, end, true
+}
+
+// Active returns the end of the window that contains t. When several do, the
+// one ending last wins.
+func Active(windows []Window, t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, w := range windows {
+		for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+			start, e, ok := w.occurrence(day)
+			if ok && !t.Before(start) && t.Before(e) && e.After(end) {
+				end = e
+			}
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// Next returns the start and end of the first window that opens after t.
+func Next(windows []Window, t time.Time) (time.Time, time.Time, bool) {
+	var nextStart, nextEnd time.Time
+	for _, w := range windows {
+		for i := 0; i <= 7; i++ {
+			start, end, ok := w.occurrence(t.AddDate(0, 0, i))
+			if !ok || !start.After(t) {
+				continue
+			}
+			if nextStart.IsZero() || start.Before(nextStart) {
+				nextStart, nextEnd = start, end
+			}
+			break
+		}
+	}
+	return nextStart, nextEnd, !nextStart.IsZero()
+}
@@ -0,0 +1,186 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, spec string) Window {
+	t.Helper()
+	w, err := Parse(spec)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", spec, err)
+	}
+	return w
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		days []time.Weekday
+	}{
+		{"Sat 02:00-06:00", []time.Weekday{time.Saturday}},
+		{"mon-wed 22:00-04:00", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday}},
+		{"Fri-Mon 01:00-03:00", []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+		{"* 00:00-00:00", []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}},
+	}
+	for _, tt := range tests {
+		w := mustParse(t, tt.spec)
+		var want [7]bool
+		for _, d := range tt.days {
+			want[d] = true
+		}
+		if w.days != want {
+			t.Errorf("Parse(%q) days = %v, want %v", tt.spec, w.days, want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"Sat",
+		"Sat 02:00",
+		"Sat 02:00-06:00 extra",
+		"Caturday 02:00-06:00",
+		"Mon-Funday 02:00-06:00",
+		"Sat 25:00-06:00",
+		"Sat 02:00-6pm",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	for _, spec := range []string{
+		"0 2 * * 6",
+		"0 2 * * 1-5 Europe/Istanbul",
+		"@weekly",
+	} {
+		_, err := Parse(spec)
+		if err == nil || !strings.Contains(err.Error(), "cron expression") {
+			t.Errorf("Parse(%q) = %v, want a cron expression error", spec, err)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		spec    string
+		t       time.Time
+		wantEnd time.Time
+		active  bool
+	}{
+		{"inside", "Sat 02:00-06:00", at(17, 3, 0), at(17, 6, 0), true},
+		{"at start", "Sat 02:00-06:00", at(17, 2, 0), at(17, 6, 0), true},
+		{"at end", "Sat 02:00-06:00", at(17, 6, 0), time.Time{}, false},
+		{"other day", "Sat 02:00-06:00", at(16, 3, 0), time.Time{}, false},
+		{"wrap-around before midnight", "Fri 22:00-04:00", at(16, 23, 0), at(17, 4, 0), true},
+		{"wrap-around after midnight", "Fri 22:00-04:00", at(17, 1, 0), at(17, 4, 0), true},
+		{"wrap-around opens on the previous day only", "Sat 22:00-04:00", at(17, 1, 0), time.Time{}, false},
+		{"weekday range wrapping the week", "Fri-Mon 01:00-03:00", at(18, 2, 0), at(18, 3, 0), true},
+		{"weekday range wrapping the week, last day", "Fri-Mon 01:00-03:00", at(19, 2, 0), at(19, 3, 0), true},
+		{"outside a weekday range wrapping the week", "Fri-Mon 01:00-03:00", at(20, 2, 0), time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, active := Active([]Window{mustParse(t, tt.spec)}, tt.t)
+			if active != tt.active || !end.Equal(tt.wantEnd) {
+				t.Errorf("Active(%q, %s) = %s, %v, want %s, %v",
+					tt.spec, tt.t, end, active, tt.wantEnd, tt.active)
+			}
+		})
+	}
+}
+
+func TestActiveOverlapping(t *testing.T) {
+	windows := []Window{mustParse(t, "* 01:00-03:00"), mustParse(t, "Sat 02:00-06:00")}
+	now := time.Date(2026, 10, 17, 2, 30, 0, 0, time.UTC)
+
+	end, active := Active(windows, now)
+	want := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	if !active || !end.Equal(want) {
+		t.Errorf("Active() = %s, %v, want %s, true", end, active, want)
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name      string
+		specs     []string
+		t         time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"later today", []string{"Fri 22:00-04:00"}, at(16, 12, 0), at(16, 22, 0), at(17, 4, 0)},
+		{"inside skips to next week", []string{"Fri 22:00-04:00"}, at(16, 23, 0), at(23, 22, 0), at(24, 4, 0)},
+		{"weekday range wrapping the week", []string{"Fri-Mon 01:00-03:00"}, at(19, 12, 0), at(23, 1, 0), at(23, 3, 0)},
+		{"earliest of several", []string{"Sun 02:00-06:00", "Sat 02:00-06:00"}, at(16, 12, 0), at(17, 2, 0), at(17, 6, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var windows []Window
+			for _, spec := range tt.specs {
+				windows = append(windows, mustParse(t, spec))
+			}
+			start, end, ok := Next(windows, tt.t)
+			if !ok || !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Next(%v, %s) = %s, %s, %v, want %s, %s, true",
+					tt.specs, tt.t, start, end, ok, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+
+	if _, _, ok := Next(nil, at(16, 12, 0)); ok {
+		t.Error("Next() without windows found one")
+	}
+}
+
+func TestDaylightSavingTime(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	// Clocks jump from 02:00 to 03:00 on Sunday 2026-03-08, so the window
+	// lasts two hours that day and keeps its wall clock times.
+	w := mustParse(t, "Sun 01:00-04:00")
+
+	start, end, ok := Next([]Window{w}, time.Date(2026, 3, 7, 12, 0, 0, 0, location))
+	wantStart := time.Date(2026, 3, 8, 1, 0, 0, 0, location)
+	wantEnd := time.Date(2026, 3, 8, 4, 0, 0, 0, location)
+	if !ok || !start.Equal(wantStart) || !end.Equal(wantEnd) {
+		t.Fatalf("Next() = %s, %s, %v, want %s, %s, true", start, end, ok, wantStart, wantEnd)
+	}
+	if got := end.Sub(start); got != 2*time.Hour {
+		t.Errorf("window lasts %s, want 2h", got)
+	}
+
+	end, active := Active([]Window{w}, time.Date(2026, 3, 8, 3, 30, 0, 0, location))
+	if !active || !end.Equal(wantEnd) {
+		t.Errorf("Active() = %s, %v, want %s, true", end, active, wantEnd)
+	}
+
+	// Clocks fall back from 02:00 to 01:00 on Sunday 2026-11-01, so a window
+	// wrapping midnight into that day lasts an hour longer.
+	w = mustParse(t, "Sat 22:00-04:00")
+	end, active = Active([]Window{w}, time.Date(2026, 11, 1, 1, 30, 0, 0, location))
+	wantEnd = time.Date(2026, 11, 1, 4, 0, 0, 0, location)
+	if !active || !end.Equal(wantEnd) {
+		t.Errorf("Active() = %s, %v, want %s, true", end, active, wantEnd)
+	}
+	start = time.Date(2026, 10, 31, 22, 0, 0, 0, location)
+	if got := end.Sub(start); got != 7*time.Hour {
+		t.Errorf("window lasts %s, want 7h", got)
+	}
+}
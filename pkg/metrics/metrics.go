@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vmindtech/vke-cluster-agent/pkg/constants"
+)
+
+const namespace = "vke_cluster_agent"
+
+// Certificate sources
+const (
+	SourceLocal = "local"
+	SourceVKE   = "vke"
+)
+
+var (
+	lastSuccessfulCheck = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_check_timestamp_seconds",
+		Help:      "Unix time of the last certificate expiry check that reached VKE.",
+	})
+
+	renewalPhaseAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "renewal_phase_attempts_total",
+		Help:      "Renewal phases started.",
+	}, []string{"phase"})
+
+	renewalPhaseSuccesses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "renewal_phase_successes_total",
+		Help:      "Renewal phases that completed.",
+	}, []string{"phase"})
+
+	renewalPhaseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "renewal_phase_failures_total",
+		Help:      "Renewal phases that failed.",
+	}, []string{"phase"})
+
+	renewalPhase = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "renewal_phase",
+		Help:      "Current renewal phase, 1 for the phase the agent is in and 0 for the others.",
+	}, []string{"phase"})
+
+	serviceRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "service_restarts_total",
+		Help:      "Service restarts by systemd unit and result.",
+	}, []string{"unit", "result"})
+
+	vkeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "vke_request_duration_seconds",
+		Help:      "Latency of VKE API requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "method", "code"})
+
+	keystoneRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "keystone_request_duration_seconds",
+		Help:      "Latency of Keystone authentications.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+)
+
+var (
+	phaseMu      sync.Mutex
+	currentPhase = constants.RenewalPhaseIdle
+
+	certificates = &certificateCollector{
+		desc: prometheus.NewDesc(namespace+"_certificate_expiry_seconds",
+			"Seconds until the certificate expires, negative once it has expired.",
+			[]string{"source", "certificate"}, nil),
+		notAfter: map[certificateKey]time.Time{},
+	}
+)
+
+func init() {
+	renewalPhase.WithLabelValues(constants.RenewalPhaseIdle).Set(1)
+	prometheus.MustRegister(certificates)
+}
+
+type certificateKey struct {
+	source string
+	name   string
+}
+
+// certificateCollector reports the time left until each known certificate
+// expires, computed when the metrics are scraped.
+type certificateCollector struct {
+	desc     *prometheus.Desc
+	mu       sync.Mutex
+	notAfter map[certificateKey]time.Time
+}
+
+func (c *certificateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *certificateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, notAfter := range c.notAfter {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Until(notAfter).Seconds(), key.source, key.name)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// SetCertificateExpiry records when the certificate called name, read from
+// source, expires.
+func SetCertificateExpiry(source, name string, notAfter time.Time) {
+	certificates.mu.Lock()
+	defer certificates.mu.Unlock()
+	certificates.notAfter[certificateKey{source: source, name: name}] = notAfter
+}
+
+// ResetCertificateExpiry forgets every certificate read from source, so
+// certificates that disappeared are no longer reported.
+func ResetCertificateExpiry(source string) {
+	certificates.mu.Lock()
+	defer certificates.mu.Unlock()
+	for key := range certificates.notAfter {
+		if key.source == source {
+			delete(certificates.notAfter, key)
+		}
+	}
+}
+
+// SetLastSuccessfulCheck records the time of a successful expiry check.
+func SetLastSuccessfulCheck(t time.Time) {
+	lastSuccessfulCheck.Set(float64(t.Unix()))
+}
+
+// SetRenewalPhase records the renewal phase the agent entered.
+func SetRenewalPhase(phase string) {
+	phaseMu.Lock()
+	defer phaseMu.Unlock()
+
+	renewalPhase.WithLabelValues(currentPhase).Set(0)
+	renewalPhase.WithLabelValues(phase).Set(1)
+	currentPhase = phase
+}
+
+// ObserveRenewalPhase counts a renewal phase that ended with err.
+func ObserveRenewalPhase(phase string, err error) {
+	renewalPhaseAttempts.WithLabelValues(phase).Inc()
+	if err != nil {
+		renewalPhaseFailures.WithLabelValues(phase).Inc()
+		return
+	}
+	renewalPhaseSuccesses.WithLabelValues(phase).Inc()
+}
+
+// ObserveServiceRestart counts a restart of unit that ended with err.
+func ObserveServiceRestart(unit string, err error) {
+	serviceRestarts.WithLabelValues(unit, result(err)).Inc()
+}
+
+// ObserveKeystoneRequest records a Keystone authentication that started at
+// start and ended with err.
+func ObserveKeystoneRequest(start time.Time, err error) {
+	keystoneRequestDuration.WithLabelValues(result(err)).Observe(time.Since(start).Seconds())
+}
+
+// InstrumentVKE wraps transport so the latency of the VKE requests sent
+// through it is recorded for operation.
+func InstrumentVKE(operation string, transport http.RoundTripper) http.RoundTripper {
+	return promhttp.InstrumentRoundTripperDuration(
+		vkeRequestDuration.MustCurryWith(prometheus.Labels{"operation": operation}), transport)
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}